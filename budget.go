@@ -0,0 +1,179 @@
+package claude
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// BudgetLimit is the spending limit of a BudgetTracker. Zero fields are
+// unlimited.
+type BudgetLimit struct {
+	// MaxCostUSD limits the total cost reported by the CLI.
+	MaxCostUSD float64
+	// MaxTokens limits the total of input and output tokens. Cache reads and
+	// writes are not counted.
+	MaxTokens int
+}
+
+// BudgetSnapshot is the state of a BudgetTracker at one point in time.
+type BudgetSnapshot struct {
+	Limit BudgetLimit
+	// CostUSD and Usage are the totals of all recorded results.
+	CostUSD float64
+	Usage   Usage
+	// Calls counts the recorded results, Refused the calls that were not
+	// started because a limit had been reached.
+	Calls   int64
+	Refused int64
+	// RemainingUSD is the cost allowance left, or -1 without a cost limit.
+	RemainingUSD float64
+	// Exhausted reports whether a limit has been reached.
+	Exhausted bool
+}
+
+// BudgetTracker adds up the cost and tokens of the calls of the clients it is
+// attached to with WithBudgetTracker, for example to limit the spending of a
+// job, a user or a day. Once a limit is reached, further calls fail with an
+// *Error of kind KindBudget before the CLI is started. Calls running at the
+// same time share the remaining allowance, so together they may exceed it.
+//
+// A BudgetTracker is safe for concurrent use.
+type BudgetTracker struct {
+	mu      sync.Mutex
+	limit   BudgetLimit
+	cost    float64
+	usage   Usage
+	calls   int64
+	refused int64
+}
+
+// NewBudgetTracker creates a BudgetTracker with the given limit.
+func NewBudgetTracker(limit BudgetLimit) *BudgetTracker {
+	return &BudgetTracker{limit: limit}
+}
+
+// WithBudgetTracker records the cost of every call in the trackers and
+// refuses calls once one of them is exhausted. The --max-budget-usd flag of
+// each call is lowered to the smallest remaining cost allowance. Ask runs
+// with JSON output so that its cost is known, and calls do not use a Pool
+// while a tracker has a cost limit. The flag of a Session is set when it is
+// opened; its turns are refused once a tracker is exhausted.
+func WithBudgetTracker(trackers ...*BudgetTracker) Option {
+	return func(c *Client) {
+		c.budgets = append(slices.Clip(c.budgets), trackers...)
+	}
+}
+
+// Add records the cost and usage of resp. Results of calls made by attached
+// clients are recorded automatically; Add is for results obtained elsewhere.
+func (b *BudgetTracker) Add(resp *Response) {
+	if resp == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cost += resp.TotalCostUSD
+	b.usage = b.usage.Add(resp.Usage)
+	b.calls++
+}
+
+// Reset clears the totals and counters, for example at the start of a new
+// day, and keeps the limit.
+func (b *BudgetTracker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cost, b.usage, b.calls, b.refused = 0, Usage{}, 0, 0
+}
+
+// Snapshot returns the current totals.
+func (b *BudgetTracker) Snapshot() BudgetSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BudgetSnapshot{
+		Limit:        b.limit,
+		CostUSD:      b.cost,
+		Usage:        b.usage,
+		Calls:        b.calls,
+		Refused:      b.refused,
+		RemainingUSD: -1,
+		Exhausted:    b.exhausted(),
+	}
+	if b.limit.MaxCostUSD > 0 {
+		st.RemainingUSD = max(b.limit.MaxCostUSD-b.cost, 0)
+	}
+	return st
+}
+
+// exhausted reports whether a limit has been reached. b.mu must be held.
+func (b *BudgetTracker) exhausted() bool {
+	return (b.limit.MaxCostUSD > 0 && b.cost >= b.limit.MaxCostUSD) ||
+		(b.limit.MaxTokens > 0 && b.usage.InputTokens+b.usage.OutputTokens >= b.limit.MaxTokens)
+}
+
+// admit checks whether a call may start. It returns the remaining cost
+// allowance, or -1 without a cost limit.
+func (b *BudgetTracker) admit() (float64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exhausted() {
+		b.refused++
+		return 0, &Error{
+			Kind:     KindBudget,
+			ExitCode: -1,
+			Err:      fmt.Errorf("budget tracker limit reached ($%.4f, %d tokens used)", b.cost, b.usage.InputTokens+b.usage.OutputTokens),
+		}
+	}
+	if b.limit.MaxCostUSD <= 0 {
+		return -1, nil
+	}
+	return b.limit.MaxCostUSD - b.cost, nil
+}
+
+// admitBudget checks c's trackers before a call and lowers the
+// --max-budget-usd flag in args to the smallest remaining allowance.
+func (c *Client) admitBudget(args []string) ([]string, error) {
+	budget := c.maxBudget
+	for _, b := range c.budgets {
+		remaining, err := b.admit()
+		if err != nil {
+			return nil, err
+		}
+		if remaining >= 0 && (budget <= 0 || remaining < budget) {
+			budget = remaining
+		}
+	}
+	if budget <= 0 || budget == c.maxBudget {
+		return args, nil
+	}
+	// Round down to a millionth of a dollar to keep the flag readable.
+	value := strconv.FormatFloat(max(math.Floor(budget*1e6)/1e6, 1e-6), 'f', -1, 64)
+	// The flag follows the prompt, so search from the end.
+	for i := len(args) - 2; i >= 0; i-- {
+		if args[i] == "--max-budget-usd" {
+			args = slices.Clone(args)
+			args[i+1] = value
+			return args, nil
+		}
+	}
+	return append(slices.Clip(args), "--max-budget-usd", value), nil
+}
+
+// chargeBudget records resp in c's trackers.
+func (c *Client) chargeBudget(resp *Response) {
+	for _, b := range c.budgets {
+		b.Add(resp)
+	}
+}
+
+// hasCostLimit reports whether one of c's trackers limits the cost.
+func (c *Client) hasCostLimit() bool {
+	for _, b := range c.budgets {
+		if b.limit.MaxCostUSD > 0 {
+			return true
+		}
+	}
+	return false
+}
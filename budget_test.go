@@ -0,0 +1,130 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// costRunner answers every call with a result costing cost and records the
+// --max-budget-usd flag of each call.
+type costRunner struct {
+	cost float64
+
+	mu      sync.Mutex
+	budgets []string
+}
+
+func (r *costRunner) Run(ctx context.Context, cmd *Command) error {
+	budget := ""
+	if i := slices.Index(cmd.Args, "--max-budget-usd"); i >= 0 {
+		budget = cmd.Args[i+1]
+	}
+	r.mu.Lock()
+	r.budgets = append(r.budgets, budget)
+	r.mu.Unlock()
+
+	line := fmt.Sprintf(`{"type":"result","subtype":"success","result":"ok","session_id":"s1","total_cost_usd":%g,"usage":{"input_tokens":10,"output_tokens":5}}`, r.cost)
+	if i := slices.Index(cmd.Args, "--output-format"); i >= 0 && cmd.Args[i+1] == "stream-json" {
+		line += "\n"
+	}
+	io.WriteString(cmd.Stdout, line)
+	return nil
+}
+
+func TestBudgetTrackerAcrossClients(t *testing.T) {
+	r := &costRunner{cost: 0.4}
+	tracker := NewBudgetTracker(BudgetLimit{MaxCostUSD: 1})
+	a := NewClient(WithRunner(r), WithBudgetTracker(tracker))
+	b := NewClient(WithRunner(r), WithBudgetTracker(tracker), WithMaxBudget(0.5))
+	ctx := context.Background()
+
+	if text, err := a.Ask(ctx, "one"); err != nil || text != "ok" {
+		t.Fatalf("Ask = %q, %v", text, err)
+	}
+	if _, err := b.Stream(ctx, "two").Result(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.AskJSON(ctx, "three"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.AskJSON(ctx, "four")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want ErrBudgetExceeded", err)
+	}
+
+	// The flag is lowered to the remaining allowance, but never raised.
+	if want := []string{"1", "0.5", "0.199999"}; !slices.Equal(r.budgets, want) {
+		t.Errorf("--max-budget-usd = %q, want %q", r.budgets, want)
+	}
+	st := tracker.Snapshot()
+	if st.Calls != 3 || st.Refused != 1 || !st.Exhausted || st.RemainingUSD != 0 || st.Usage.OutputTokens != 15 {
+		t.Errorf("snapshot = %+v", st)
+	}
+
+	tracker.Reset()
+	if _, err := b.AskJSON(ctx, "five"); err != nil {
+		t.Errorf("after Reset: %v", err)
+	}
+}
+
+func TestBudgetTrackerTokenLimit(t *testing.T) {
+	r := &costRunner{}
+	day := NewBudgetTracker(BudgetLimit{MaxTokens: 20})
+	job := NewBudgetTracker(BudgetLimit{})
+	c := NewClient(WithRunner(r), WithBudgetTracker(day, job))
+
+	for range 2 {
+		if _, err := c.AskJSON(context.Background(), "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.AskJSON(context.Background(), "hi"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v", err)
+	}
+	if st := job.Snapshot(); st.Calls != 2 || st.Exhausted || st.RemainingUSD != -1 {
+		t.Errorf("job snapshot = %+v", st)
+	}
+	if r.budgets[0] != "" {
+		t.Errorf("--max-budget-usd = %q without a cost limit", r.budgets[0])
+	}
+}
+
+func TestBudgetTrackerPooled(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{})
+	defer pool.Close()
+	trackerA := NewBudgetTracker(BudgetLimit{})
+	trackerB := NewBudgetTracker(BudgetLimit{MaxTokens: 3})
+	a := NewClient(WithRunner(cli), WithPool(pool), WithBudgetTracker(trackerA))
+	b := NewClient(WithRunner(cli), WithPool(pool), WithBudgetTracker(trackerB))
+
+	pool.Warm(a)
+	waitFor(t, "warm process", func() bool { return pool.Stats().Idle == 1 })
+	if _, err := b.AskJSON(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if st := pool.Stats(); st.Hits != 1 {
+		t.Errorf("pool stats = %+v, want the call served by A's warm process", st)
+	}
+	if st := trackerA.Snapshot(); st.Calls != 0 {
+		t.Errorf("A snapshot = %+v, want no calls", st)
+	}
+	if st := trackerB.Snapshot(); st.Calls != 1 || st.Usage.OutputTokens != 3 || !st.Exhausted {
+		t.Errorf("B snapshot = %+v", st)
+	}
+
+	if _, err := b.AskJSON(context.Background(), "again"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v, want B's token limit enforced", err)
+	}
+	if _, err := a.AskJSON(context.Background(), "hi"); err != nil {
+		t.Errorf("A: %v", err)
+	}
+	if st := trackerA.Snapshot(); st.Calls != 1 {
+		t.Errorf("A snapshot = %+v", st)
+	}
+}
@@ -0,0 +1,396 @@
+// Package cassette records CLI interactions of a claude.Client to a file and
+// replays them deterministically, for regression tests and offline demos.
+//
+// A Recorder is a claude.Runner, so replayed output goes through the same
+// parsing code as a real run:
+//
+//	rec, err := cassette.New("testdata/summary.json", cassette.ModeReplay)
+//	client := claude.NewClient(claude.WithRunner(rec))
+//
+// Interactions are matched on the normalized argv and stdin. Cassette files
+// are indented JSON and are written after every recorded interaction.
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	claude "github.com/shaul1991/claude-go"
+)
+
+// Mode selects how a Recorder treats the cassette.
+type Mode int
+
+const (
+	// ModeReplay serves recorded interactions only. A call without a
+	// recording fails with ErrNoInteraction. The cassette file must exist.
+	ModeReplay Mode = iota
+	// ModeRecordMissing replays recorded interactions and runs and records
+	// calls that have no recording yet.
+	ModeRecordMissing
+	// ModeRecord runs every call and records it, replacing the cassette's
+	// previous contents.
+	ModeRecord
+)
+
+// ErrNoInteraction is returned in ModeReplay when no unused recorded
+// interaction matches a call.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// ErrStreamInput is returned for processes that read stream-json input, such
+// as sessions and pooled processes. Their stdin stays open for the whole
+// conversation, so they cannot be matched or recorded.
+var ErrStreamInput = errors.New("cassette: stream-json input is not supported")
+
+// version is the cassette file format version.
+const version = 1
+
+// Cassette is the file format: a list of recorded interactions.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded CLI invocation.
+type Interaction struct {
+	// Args are the normalized CLI arguments, excluding the executable.
+	Args []string `json:"args"`
+	// Stdin is the data written to the process's standard input.
+	Stdin string `json:"stdin,omitempty"`
+	// Stdout holds the standard output, split into lines with the time at
+	// which each was written.
+	Stdout []Chunk `json:"stdout"`
+	// Stderr is the standard error output.
+	Stderr string `json:"stderr,omitempty"`
+	// ExitCode is the process exit status.
+	ExitCode int `json:"exit_code"`
+	// DurationMS is the run time of the process in milliseconds.
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Chunk is a piece of output, normally one line including its newline.
+type Chunk struct {
+	// OffsetMS is the time since the process started, in milliseconds.
+	OffsetMS int64  `json:"offset_ms"`
+	Data     string `json:"data"`
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithRunner sets the Runner used for calls that are recorded
+// (default claude.ExecRunner).
+func WithRunner(r claude.Runner) Option {
+	return func(rec *Recorder) {
+		rec.runner = r
+	}
+}
+
+// WithNormalizer replaces the argv normalization applied before recording and
+// matching. The default is NormalizeArgs.
+func WithNormalizer(fn func(args []string) []string) Option {
+	return func(rec *Recorder) {
+		rec.normalize = fn
+	}
+}
+
+// WithRealtime replays output with the recorded timing between chunks
+// instead of all at once.
+func WithRealtime() Option {
+	return func(rec *Recorder) {
+		rec.realtime = true
+	}
+}
+
+// Recorder is a claude.Runner that records and replays interactions.
+// It is safe for concurrent use.
+type Recorder struct {
+	path      string
+	mode      Mode
+	runner    claude.Runner
+	normalize func([]string) []string
+	realtime  bool
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     map[*Interaction]bool
+}
+
+// New opens the cassette at path in the given mode.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	rec := &Recorder{
+		path:      path,
+		mode:      mode,
+		runner:    claude.ExecRunner{},
+		normalize: NormalizeArgs,
+		cassette:  Cassette{Version: version},
+		used:      map[*Interaction]bool{},
+	}
+	for _, opt := range opts {
+		opt(rec)
+	}
+	if mode == ModeRecord {
+		return rec, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode == ModeRecordMissing {
+		return rec, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &rec.cassette); err != nil {
+		return nil, fmt.Errorf("cassette: parse %s: %w", path, err)
+	}
+	if rec.cassette.Version != version {
+		return nil, fmt.Errorf("cassette: %s: unsupported version %d", path, rec.cassette.Version)
+	}
+	return rec, nil
+}
+
+// Interactions returns the interactions currently in the cassette.
+func (rec *Recorder) Interactions() []*Interaction {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]*Interaction(nil), rec.cassette.Interactions...)
+}
+
+// Run replays a matching interaction or, depending on the mode, runs and
+// records cmd.
+func (rec *Recorder) Run(ctx context.Context, cmd *claude.Command) error {
+	if streamInput(cmd.Args) {
+		return ErrStreamInput
+	}
+	var stdin []byte
+	if cmd.Stdin != nil {
+		var err error
+		if stdin, err = io.ReadAll(cmd.Stdin); err != nil {
+			return fmt.Errorf("cassette: read stdin: %w", err)
+		}
+	}
+	args := rec.normalize(cmd.Args)
+
+	if rec.mode != ModeRecord {
+		if it := rec.claim(args, string(stdin)); it != nil {
+			return rec.replay(ctx, cmd, it)
+		}
+		if rec.mode == ModeReplay {
+			return fmt.Errorf("%w for args %q", ErrNoInteraction, args)
+		}
+	}
+	return rec.record(ctx, cmd, args, stdin)
+}
+
+// claim returns the first unused interaction matching args and stdin and
+// marks it used.
+func (rec *Recorder) claim(args []string, stdin string) *Interaction {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, it := range rec.cassette.Interactions {
+		if !rec.used[it] && it.Stdin == stdin && equalArgs(it.Args, args) {
+			rec.used[it] = true
+			return it
+		}
+	}
+	return nil
+}
+
+// replay writes the recorded output of it to cmd.
+func (rec *Recorder) replay(ctx context.Context, cmd *claude.Command, it *Interaction) error {
+	start := time.Now()
+	for _, c := range it.Stdout {
+		if rec.realtime {
+			if err := sleepUntil(ctx, start.Add(time.Duration(c.OffsetMS)*time.Millisecond)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(cmd.Stdout, c.Data); err != nil {
+			return err
+		}
+	}
+	if rec.realtime {
+		if err := sleepUntil(ctx, start.Add(time.Duration(it.DurationMS)*time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	if it.Stderr != "" && cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, it.Stderr)
+	}
+	if it.ExitCode != 0 {
+		return &claude.ExitError{Code: it.ExitCode}
+	}
+	return nil
+}
+
+// record runs cmd with the underlying runner and saves the interaction if
+// the process ran to completion.
+func (rec *Recorder) record(ctx context.Context, cmd *claude.Command, args []string, stdin []byte) error {
+	start := time.Now()
+	stdout := &chunkWriter{w: cmd.Stdout, start: start}
+	var stderr bytes.Buffer
+
+	run := *cmd
+	if cmd.Stdin != nil {
+		run.Stdin = bytes.NewReader(stdin)
+	}
+	run.Stdout = stdout
+	run.Stderr = &stderr
+	if cmd.Stderr != nil {
+		run.Stderr = io.MultiWriter(&stderr, cmd.Stderr)
+	}
+
+	err := rec.runner.Run(ctx, &run)
+	stdout.flush()
+
+	exitCode := 0
+	if err != nil {
+		var coder interface{ ExitCode() int }
+		if !errors.As(err, &coder) || ctx.Err() != nil {
+			// The process did not run to completion; there is nothing
+			// reproducible to record.
+			return err
+		}
+		exitCode = coder.ExitCode()
+	}
+
+	it := &Interaction{
+		Args:       args,
+		Stdin:      string(stdin),
+		Stdout:     stdout.chunks,
+		Stderr:     stderr.String(),
+		ExitCode:   exitCode,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if it.Stdout == nil {
+		it.Stdout = []Chunk{}
+	}
+	if serr := rec.add(it); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// add appends it to the cassette and saves the file.
+func (rec *Recorder) add(it *Interaction) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.cassette.Interactions = append(rec.cassette.Interactions, it)
+	rec.used[it] = true
+	return rec.save()
+}
+
+// save writes the cassette atomically. rec.mu must be held.
+func (rec *Recorder) save() error {
+	data, err := json.MarshalIndent(rec.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: encode: %w", err)
+	}
+	if dir := filepath.Dir(rec.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cassette: %w", err)
+		}
+	}
+	tmp := rec.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	if err := os.Rename(tmp, rec.path); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	return nil
+}
+
+// NormalizeArgs is the default argv normalization. It replaces arguments
+// that are paths inside the system temporary directory, such as generated
+// config files, with "<tmp>" so that recordings match across runs.
+func NormalizeArgs(args []string) []string {
+	tmp := filepath.Clean(os.TempDir()) + string(filepath.Separator)
+	out := make([]string, len(args))
+	for i, a := range args {
+		if strings.HasPrefix(a, tmp) {
+			a = "<tmp>"
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// streamInput reports whether args select stream-json input.
+func streamInput(args []string) bool {
+	for i, a := range args {
+		if a == "--input-format=stream-json" || a == "--input-format" && i+1 < len(args) && args[i+1] == "stream-json" {
+			return true
+		}
+	}
+	return false
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// chunkWriter passes output through to w and splits it into timed lines.
+type chunkWriter struct {
+	w       io.Writer
+	start   time.Time
+	partial []byte
+	chunks  []Chunk
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	offset := time.Since(cw.start).Milliseconds()
+	cw.partial = append(cw.partial, p...)
+	for {
+		i := bytes.IndexByte(cw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		cw.chunks = append(cw.chunks, Chunk{OffsetMS: offset, Data: string(cw.partial[:i+1])})
+		cw.partial = cw.partial[i+1:]
+	}
+	if cw.w == nil {
+		return len(p), nil
+	}
+	return cw.w.Write(p)
+}
+
+// flush records output not terminated by a newline.
+func (cw *chunkWriter) flush() {
+	if len(cw.partial) > 0 {
+		cw.chunks = append(cw.chunks, Chunk{OffsetMS: time.Since(cw.start).Milliseconds(), Data: string(cw.partial)})
+		cw.partial = nil
+	}
+}
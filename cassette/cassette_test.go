@@ -0,0 +1,225 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	claude "github.com/shaul1991/claude-go"
+)
+
+// fakeCLI answers like the CLI would for the requested output format and
+// counts its invocations.
+func fakeCLI(calls *atomic.Int32) claude.Runner {
+	return claude.RunnerFunc(func(ctx context.Context, cmd *claude.Command) error {
+		calls.Add(1)
+		format := ""
+		prompt := ""
+		for i, a := range cmd.Args {
+			switch {
+			case a == "--output-format" && i+1 < len(cmd.Args):
+				format = cmd.Args[i+1]
+			case a == "-p" && i+1 < len(cmd.Args):
+				prompt = cmd.Args[i+1]
+			}
+		}
+		if prompt == "fail" {
+			io.WriteString(cmd.Stderr, "API Error: 429 rate limit")
+			return &claude.ExitError{Code: 1}
+		}
+		switch format {
+		case "json":
+			io.WriteString(cmd.Stdout, `{"result":"4","session_id":"s1"}`+"\n")
+		case "stream-json":
+			io.WriteString(cmd.Stdout, `{"type":"system","subtype":"init","session_id":"s1","model":"m"}`+"\n")
+			io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"4","session_id":"s1"}`+"\n")
+		default:
+			io.WriteString(cmd.Stdout, "4\n")
+		}
+		return nil
+	})
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	var calls atomic.Int32
+	ctx := context.Background()
+
+	rec, err := New(path, ModeRecord, WithRunner(fakeCLI(&calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := claude.NewClient(claude.WithRunner(rec))
+	if _, err := client.Ask(ctx, "2+2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AskJSON(ctx, "2+2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stream(ctx, "2+2").Result(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Ask(ctx, "fail"); err == nil {
+		t.Fatal("expected error")
+	}
+	if n := len(rec.Interactions()); n != 4 {
+		t.Fatalf("recorded %d interactions, want 4", n)
+	}
+
+	replay, err := New(path, ModeReplay, WithRunner(fakeCLI(&calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls.Store(0)
+	client = claude.NewClient(claude.WithRunner(replay))
+
+	text, err := client.Ask(ctx, "2+2")
+	if err != nil || text != "4" {
+		t.Errorf("Ask = %q, %v", text, err)
+	}
+	resp, err := client.AskJSON(ctx, "2+2")
+	if err != nil || resp.SessionID != "s1" {
+		t.Errorf("AskJSON = %+v, %v", resp, err)
+	}
+	s := client.Stream(ctx, "2+2")
+	var n int
+	for range s.Events() {
+		n++
+	}
+	if resp, err := s.Result(); err != nil || resp.Model != "m" || n != 2 {
+		t.Errorf("Stream = %+v, %v (%d events)", resp, err, n)
+	}
+	_, err = client.Ask(ctx, "fail")
+	var cerr *claude.Error
+	if !errors.As(err, &cerr) || cerr.ExitCode != 1 || !errors.Is(err, claude.ErrRateLimited) {
+		t.Errorf("replayed error = %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("replay ran the CLI %d times", calls.Load())
+	}
+}
+
+func TestReplayStrictMiss(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	var calls atomic.Int32
+	rec, err := New(path, ModeRecord, WithRunner(fakeCLI(&calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := claude.NewClient(claude.WithRunner(rec)).Ask(context.Background(), "2+2"); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := claude.NewClient(claude.WithRunner(replay))
+	if _, err := client.Ask(context.Background(), "3+3"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("different prompt: err = %v, want ErrNoInteraction", err)
+	}
+	if _, err := client.Ask(context.Background(), "2+2"); err != nil {
+		t.Fatal(err)
+	}
+	// Each interaction is served once.
+	if _, err := client.Ask(context.Background(), "2+2"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("reused interaction: err = %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestReplayMissingFile(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Error("expected error for missing cassette")
+	}
+}
+
+func TestRecordMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	var calls atomic.Int32
+	ctx := context.Background()
+
+	for _, prompts := range [][]string{{"a"}, {"a", "b"}} {
+		rec, err := New(path, ModeRecordMissing, WithRunner(fakeCLI(&calls)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := claude.NewClient(claude.WithRunner(rec))
+		for _, p := range prompts {
+			if _, err := client.Ask(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("CLI ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestStdinMatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	var calls atomic.Int32
+	rec, err := New(path, ModeRecordMissing, WithRunner(fakeCLI(&calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := claude.NewClient(claude.WithRunner(rec))
+	for _, input := range []string{"x", "y", "x"} {
+		if _, err := client.Pipe(context.Background(), strings.NewReader(input), "summarize"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rec.Interactions(); len(got) != 3 || got[1].Stdin != "y" {
+		t.Errorf("interactions = %+v", got)
+	}
+}
+
+func TestStreamInputRejected(t *testing.T) {
+	var calls atomic.Int32
+	rec, err := New(filepath.Join(t.TempDir(), "cassette.json"), ModeRecordMissing, WithRunner(fakeCLI(&calls)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, w := io.Pipe()
+	defer w.Close()
+	cmd := &claude.Command{
+		Args:   []string{"-p", "--input-format", "stream-json", "--output-format", "stream-json"},
+		Stdin:  stdin,
+		Stdout: io.Discard,
+	}
+	if err := rec.Run(context.Background(), cmd); !errors.Is(err, ErrStreamInput) {
+		t.Errorf("err = %v, want ErrStreamInput", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("runner called %d times", calls.Load())
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	tmp := filepath.Join(os.TempDir(), "claude-mcp-123.json")
+	got := NormalizeArgs([]string{"-p", "hi", "--mcp-config", tmp})
+	want := []string{"-p", "hi", "--mcp-config", "<tmp>"}
+	if !equalArgs(got, want) {
+		t.Errorf("NormalizeArgs = %q, want %q", got, want)
+	}
+}
+
+func TestChunkWriterSplitsLines(t *testing.T) {
+	var sink strings.Builder
+	cw := &chunkWriter{w: &sink}
+	io.WriteString(cw, "a\nb")
+	io.WriteString(cw, "c\nd")
+	cw.flush()
+
+	var data []string
+	for _, c := range cw.chunks {
+		data = append(data, c.Data)
+	}
+	if strings.Join(data, "|") != "a\n|bc\n|d" || sink.String() != "a\nbc\nd" {
+		t.Errorf("chunks = %q, passthrough = %q", data, sink.String())
+	}
+}
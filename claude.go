@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"maps"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Client wraps the claude CLI.
@@ -20,12 +25,44 @@ type Client struct {
 	maxTurns     int
 	maxBudget    float64
 	workDir      string
+	retryPolicy  *RetryPolicy
+	runner       Runner
+	// runnerID identifies runner to a Pool; nil means runner itself.
+	runnerID any
+
+	disallowedTools []string
+	permissionMode  PermissionMode
+	addDirs         []string
+	settings        string
+	fallbackModel   string
+	sessionID       string
+	forkSession     bool
+	strictMCPConfig bool
+	agents          map[string]Agent
+	verbose         bool
+	extraArgs       []string
+	mcpServers      map[string]MCPServer
+	tools           []ToolDef
+	hooks           []Hook
+	pool            *Pool
+	limiter         *limiter
+	maxQueue        int
+	budgets         []*BudgetTracker
+	streamBudget    StreamBudget
+	limits          ResourceLimits
+	wallClock       time.Duration
+
+	permissionHandler PermissionHandler
+
+	schemaRepairs int
 }
 
 // NewClient creates a new Client with the given options.
 func NewClient(opts ...Option) *Client {
 	c := &Client{
-		cliPath: "claude",
+		cliPath:  "claude",
+		runner:   ExecRunner{},
+		maxQueue: -1,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -33,6 +70,30 @@ func NewClient(opts ...Option) *Client {
 	return c
 }
 
+// With returns a copy of the client with opts applied on top of its
+// settings. The original client is not modified, so a shared base client can
+// be specialized per request from many goroutines.
+func (c *Client) With(opts ...Option) *Client {
+	clone := *c
+	for _, opt := range opts {
+		opt(&clone)
+	}
+	return &clone
+}
+
+// forCall returns the client to use for a call with per-call options: c
+// itself when there are none, otherwise a copy with opts applied.
+func (c *Client) forCall(opts []CallOption) *Client {
+	if len(opts) == 0 {
+		return c
+	}
+	clone := *c
+	for _, opt := range opts {
+		opt(&clone)
+	}
+	return &clone
+}
+
 // buildArgs assembles the CLI arguments for a given prompt and output format.
 // Extra flags (e.g. --resume, --continue) can be appended via extra.
 func (c *Client) buildArgs(prompt string, format OutputFormat, extra ...string) []string {
@@ -54,122 +115,382 @@ func (c *Client) buildArgs(prompt string, format OutputFormat, extra ...string)
 	for _, tool := range c.allowedTools {
 		args = append(args, "--allowedTools", tool)
 	}
+	for _, tool := range c.tools {
+		args = append(args, "--allowedTools", toolName(tool.Name))
+	}
 	if c.maxTurns > 0 {
 		args = append(args, "--max-turns", strconv.Itoa(c.maxTurns))
 	}
 	if c.maxBudget > 0 {
 		args = append(args, "--max-budget-usd", strconv.FormatFloat(c.maxBudget, 'f', -1, 64))
 	}
+	for _, tool := range c.disallowedTools {
+		args = append(args, "--disallowedTools", tool)
+	}
+	if c.permissionMode != "" {
+		args = append(args, "--permission-mode", string(c.permissionMode))
+	}
+	if c.permissionHandler != nil {
+		args = append(args, "--permission-prompt-tool", toolName(permissionToolName))
+	}
+	for _, dir := range c.addDirs {
+		args = append(args, "--add-dir", dir)
+	}
+	// With hooks, the settings are merged into a generated file by prepare.
+	if c.settings != "" && len(c.hooks) == 0 {
+		args = append(args, "--settings", c.settings)
+	}
+	if c.fallbackModel != "" {
+		args = append(args, "--fallback-model", c.fallbackModel)
+	}
+	// A resumed session keeps its ID unless it is forked, so --session-id
+	// only applies to new sessions and forks.
+	resuming := slices.Contains(extra, "--resume") || slices.Contains(extra, "--continue")
+	forking := c.forkSession || slices.Contains(extra, "--fork-session")
+	if c.sessionID != "" && (!resuming || forking) {
+		args = append(args, "--session-id", c.sessionID)
+	}
+	if c.forkSession && !slices.Contains(extra, "--fork-session") {
+		args = append(args, "--fork-session")
+	}
+	if c.strictMCPConfig {
+		args = append(args, "--strict-mcp-config")
+	}
+	if len(c.agents) > 0 {
+		// Agent only holds strings, so marshaling cannot fail.
+		agents, _ := json.Marshal(c.agents)
+		args = append(args, "--agents", string(agents))
+	}
+	if c.verbose && format != FormatStreamJSON {
+		args = append(args, "--verbose")
+	}
+	args = append(args, c.extraArgs...)
 	args = append(args, extra...)
 	return args
 }
 
-// newCmd creates an *exec.Cmd with working directory set if configured.
-func (c *Client) newCmd(ctx context.Context, args []string) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, c.cliPath, args...)
-	if c.workDir != "" {
-		cmd.Dir = c.workDir
+// managedFlags maps CLI flags set by the library to the option that controls them.
+var managedFlags = map[string]string{
+	"-p":                         "the prompt argument",
+	"--print":                    "the prompt argument",
+	"--output-format":            "the method called",
+	"--input-format":             "the method called",
+	"--include-partial-messages": "the streaming methods",
+	"--output-schema":            "AskWithSchema",
+	"-r":                         "Resume",
+	"--resume":                   "Resume",
+	"-c":                         "Continue",
+	"--continue":                 "Continue",
+	"--model":                    "WithModel",
+	"--system-prompt":            "WithSystemPrompt",
+	"--append-system-prompt":     "WithAppendSystemPrompt",
+	"--allowedTools":             "WithAllowedTools",
+	"--allowed-tools":            "WithAllowedTools",
+	"--disallowedTools":          "WithDisallowedTools",
+	"--disallowed-tools":         "WithDisallowedTools",
+	"--max-turns":                "WithMaxTurns",
+	"--max-budget-usd":           "WithMaxBudget",
+	"--permission-mode":          "WithPermissionMode",
+	"--permission-prompt-tool":   "WithPermissionHandler",
+	"--add-dir":                  "WithAddDirs",
+	"--settings":                 "WithSettings",
+	"--fallback-model":           "WithFallbackModel",
+	"--session-id":               "WithSessionID",
+	"--fork-session":             "WithForkSession",
+	"--strict-mcp-config":        "WithStrictMCPConfig",
+	"--agents":                   "WithAgents",
+	"--verbose":                  "WithVerbose",
+}
+
+// checkExtraArgs reports an error if the WithExtraArgs arguments contain a
+// flag managed by the library.
+func (c *Client) checkExtraArgs() error {
+	for _, arg := range c.extraArgs {
+		name, _, _ := strings.Cut(arg, "=")
+		if use, ok := managedFlags[name]; ok {
+			return fmt.Errorf("claude: WithExtraArgs: flag %s is managed by the library; use %s", name, use)
+		}
+	}
+	return nil
+}
+
+// prepare validates the client configuration for an invocation with args and
+// creates the resources it needs: the tool server for Go tools and the
+// permission handler, the MCP config file, and the hook server with its
+// settings file. If events is non-nil, tool
+// calls are reported on it; permission decisions are recorded in log.
+// prepare returns the final arguments and a cleanup function that must be
+// called once the process has exited.
+func (c *Client) prepare(ctx context.Context, args []string, events chan<- StreamEvent, log *callLog) (_ []string, _ func(), err error) {
+	if err := c.checkExtraArgs(); err != nil {
+		return nil, nil, err
+	}
+	args, err = c.admitBudget(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	servers := c.mcpServers
+	tools := c.tools
+	if c.permissionHandler != nil {
+		tools = append(slices.Clip(tools), permissionTool(c.permissionHandler, log))
+	}
+	if len(tools) > 0 {
+		if _, ok := servers[toolServerName]; ok {
+			return nil, nil, fmt.Errorf("claude: MCP server name %q is reserved for Go tools", toolServerName)
+		}
+		ts, err := startToolServer(ctx, tools, events)
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, ts.close)
+		servers = maps.Clone(servers)
+		if servers == nil {
+			servers = map[string]MCPServer{}
+		}
+		servers[toolServerName] = ts.mcpServer()
+	}
+
+	if len(servers) > 0 {
+		path, err := writeMCPConfig(servers)
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, func() { os.Remove(path) })
+		args = append(slices.Clip(args), "--mcp-config", path)
+	}
+
+	if len(c.hooks) > 0 {
+		if lr, ok := c.runner.(LocalRunner); !ok || !lr.Local() {
+			return nil, nil, errors.New("claude: hooks require a LocalRunner such as ExecRunner")
+		}
+		hs, err := startHookServer(ctx, c.hooks)
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, hs.close)
+		path, err := hs.writeSettings(c.settings, c.workDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(slices.Clip(args), "--settings", path)
+	}
+	return args, cleanup, nil
+}
+
+// command creates the Command for a CLI invocation with args.
+func (c *Client) command(args []string) *Command {
+	cmd := &Command{
+		Path: c.cliPath,
+		Args: args,
+		Dir:  c.workDir,
+	}
+	if !c.limits.isZero() {
+		limits := c.limits
+		cmd.Limits = &limits
 	}
 	return cmd
 }
 
 // Ask runs the prompt and returns the plain-text response.
-func (c *Client) Ask(ctx context.Context, prompt string) (string, error) {
-	args := c.buildArgs(prompt, FormatText)
-	cmd := c.newCmd(ctx, args)
-
-	out, err := cmd.Output()
+func (c *Client) Ask(ctx context.Context, prompt string, opts ...CallOption) (string, error) {
+	c = c.forCall(opts)
+	if s := c.pooledStream(ctx, prompt); s != nil {
+		resp, err := s.Result()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(resp.Result), nil
+	}
+	if len(c.budgets) > 0 {
+		// The text output does not report the cost.
+		resp, err := c.runJSON(ctx, c.buildArgs(prompt, FormatJSON))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(resp.Result), nil
+	}
+	out, err := c.run(ctx, c.buildArgs(prompt, FormatText), nil, nil)
 	if err != nil {
-		return "", wrapExecError(err)
+		return "", err
 	}
 	return string(bytes.TrimSpace(out)), nil
 }
 
 // AskJSON runs the prompt with JSON output and returns a parsed Response.
-func (c *Client) AskJSON(ctx context.Context, prompt string) (*Response, error) {
-	args := c.buildArgs(prompt, FormatJSON)
-	cmd := c.newCmd(ctx, args)
+func (c *Client) AskJSON(ctx context.Context, prompt string, opts ...CallOption) (*Response, error) {
+	c = c.forCall(opts)
+	if s := c.pooledStream(ctx, prompt); s != nil {
+		return s.Result()
+	}
+	return c.runJSON(ctx, c.buildArgs(prompt, FormatJSON))
+}
 
-	out, err := cmd.Output()
+// AskWithSchema runs the prompt with a JSON schema constraint (--output-format json --output-schema).
+// The result is validated against schema. If it does not match, the session is
+// resumed with the validation problems as configured by WithSchemaRepair; if
+// no valid result is obtained, a *ValidationError is returned together with
+// the last Response.
+func (c *Client) AskWithSchema(ctx context.Context, prompt string, schema string, opts ...CallOption) (*Response, error) {
+	c = c.forCall(opts)
+	resp, err := c.runJSON(ctx, c.buildArgs(prompt, FormatJSON, "--output-schema", schema))
 	if err != nil {
-		return nil, wrapExecError(err)
+		return resp, err
 	}
-	var resp Response
-	if err := json.Unmarshal(out, &resp); err != nil {
-		return nil, fmt.Errorf("claude: failed to parse JSON response: %w", err)
-	}
-	return &resp, nil
+	return c.repairResult(ctx, resp, schema)
 }
 
-// AskWithSchema runs the prompt with a JSON schema constraint (--output-format json --output-schema).
-func (c *Client) AskWithSchema(ctx context.Context, prompt string, schema string) (*Response, error) {
-	args := c.buildArgs(prompt, FormatJSON, "--output-schema", schema)
-	cmd := c.newCmd(ctx, args)
+// repairResult validates resp.Result against schema. On failure it resumes
+// the session, quoting the validation problems, until the result is valid or
+// the client's repair attempts are used up.
+func (c *Client) repairResult(ctx context.Context, resp *Response, schema string) (*Response, error) {
+	total, totalCost := resp.Usage, resp.TotalCostUSD
+	for attempt := 1; ; attempt++ {
+		resp.Attempts = attempt
+		resp.TotalUsage = total
+		resp.TotalCostAllAttemptsUSD = totalCost
 
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, wrapExecError(err)
+		err := validateResult(resp.Result, schema)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			return resp, err
+		}
+		if attempt > c.schemaRepairs || resp.SessionID == "" {
+			return resp, err
+		}
+
+		args := c.buildArgs(repairPrompt(verr), FormatJSON, "--resume", resp.SessionID, "--output-schema", schema)
+		next, err := c.runJSON(ctx, args)
+		if err != nil {
+			return resp, err
+		}
+		total = total.Add(next.Usage)
+		totalCost += next.TotalCostUSD
+		resp = next
 	}
-	var resp Response
-	if err := json.Unmarshal(out, &resp); err != nil {
-		return nil, fmt.Errorf("claude: failed to parse JSON response: %w", err)
+}
+
+// repairPrompt asks the model to correct a result that failed validation.
+func repairPrompt(verr *ValidationError) string {
+	var b strings.Builder
+	b.WriteString("Your previous answer does not match the required JSON schema:\n")
+	for _, p := range verr.Problems {
+		b.WriteString("- ")
+		b.WriteString(p)
+		b.WriteString("\n")
 	}
-	return &resp, nil
+	b.WriteString("Reply again with only the corrected JSON value, matching the schema exactly.")
+	return b.String()
 }
 
 // Resume continues a previous session identified by sessionID.
-func (c *Client) Resume(ctx context.Context, sessionID string, prompt string) (*Response, error) {
-	args := c.buildArgs(prompt, FormatJSON, "--resume", sessionID)
-	cmd := c.newCmd(ctx, args)
+func (c *Client) Resume(ctx context.Context, sessionID string, prompt string, opts ...CallOption) (*Response, error) {
+	c = c.forCall(opts)
+	return c.runJSON(ctx, c.buildArgs(prompt, FormatJSON, "--resume", sessionID))
+}
+
+// Continue resumes the most recent session.
+func (c *Client) Continue(ctx context.Context, prompt string, opts ...CallOption) (*Response, error) {
+	c = c.forCall(opts)
+	return c.runJSON(ctx, c.buildArgs(prompt, FormatJSON, "--continue"))
+}
 
-	out, err := cmd.Output()
+// Pipe sends input from an io.Reader as stdin to the claude process alongside the prompt.
+// When a retry policy is configured, input is read into memory so that it can
+// be replayed on each attempt.
+func (c *Client) Pipe(ctx context.Context, input io.Reader, prompt string, opts ...CallOption) (string, error) {
+	c = c.forCall(opts)
+	out, err := c.run(ctx, c.buildArgs(prompt, FormatText), input, nil)
 	if err != nil {
-		return nil, wrapExecError(err)
+		return "", err
 	}
-	var resp Response
-	if err := json.Unmarshal(out, &resp); err != nil {
-		return nil, fmt.Errorf("claude: failed to parse JSON response: %w", err)
-	}
-	return &resp, nil
+	return string(bytes.TrimSpace(out)), nil
 }
 
-// Continue resumes the most recent session.
-func (c *Client) Continue(ctx context.Context, prompt string) (*Response, error) {
-	args := c.buildArgs(prompt, FormatJSON, "--continue")
-	cmd := c.newCmd(ctx, args)
+// run executes the CLI with args and returns its stdout, retrying transient
+// failures according to the client's retry policy. The call first waits for
+// a slot under WithMaxConcurrency. Permission decisions and the queue wait are
+// recorded in log, which may be nil.
+func (c *Client) run(ctx context.Context, args []string, stdin io.Reader, log *callLog) ([]byte, error) {
+	wait, err := c.limiter.acquire(ctx, c.maxQueue)
+	if err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+	log.setQueueWait(wait)
 
-	out, err := cmd.Output()
+	args, cleanup, err := c.prepare(ctx, args, nil, log)
 	if err != nil {
-		return nil, wrapExecError(err)
+		return nil, err
 	}
-	var resp Response
-	if err := json.Unmarshal(out, &resp); err != nil {
-		return nil, fmt.Errorf("claude: failed to parse JSON response: %w", err)
+	defer cleanup()
+
+	input, err := c.inputSource(stdin)
+	if err != nil {
+		return nil, err
 	}
-	return &resp, nil
-}
 
-// Pipe sends input from an io.Reader as stdin to the claude process alongside the prompt.
-func (c *Client) Pipe(ctx context.Context, input io.Reader, prompt string) (string, error) {
-	args := c.buildArgs(prompt, FormatText)
-	cmd := c.newCmd(ctx, args)
-	cmd.Stdin = input
+	for attempt := 1; ; attempt++ {
+		var stdout, stderr bytes.Buffer
+		cmd := c.command(args)
+		cmd.Stdin = input()
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
 
-	out, err := cmd.Output()
+		err := c.execute(ctx, cmd)
+		if err == nil {
+			return stdout.Bytes(), nil
+		}
+		err = c.runError(ctx, err, stderr.String(), stdout.String())
+		if !c.retryPolicy.retry(ctx, attempt, err) {
+			return nil, err
+		}
+	}
+}
+
+// inputSource returns a function yielding the stdin for each attempt. When
+// retries are enabled, stdin is read into memory so it can be replayed.
+func (c *Client) inputSource(stdin io.Reader) (func() io.Reader, error) {
+	if stdin == nil || c.retryPolicy.attempts() <= 1 {
+		return func() io.Reader { return stdin }, nil
+	}
+	data, err := io.ReadAll(stdin)
 	if err != nil {
-		return "", wrapExecError(err)
+		return nil, fmt.Errorf("claude: read input: %w", err)
 	}
-	return string(bytes.TrimSpace(out)), nil
+	return func() io.Reader { return bytes.NewReader(data) }, nil
 }
 
-// wrapExecError extracts stderr from *exec.ExitError if available.
-func wrapExecError(err error) error {
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		stderr := string(bytes.TrimSpace(exitErr.Stderr))
-		if stderr != "" {
-			return fmt.Errorf("claude: process exited with code %d: %s", exitErr.ExitCode(), stderr)
+// runJSON executes the CLI with args and parses its JSON output.
+func (c *Client) runJSON(ctx context.Context, args []string) (*Response, error) {
+	var log callLog
+	out, err := c.run(ctx, args, nil, &log)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) && e.Result != nil {
+			log.apply(e.Result)
+			c.chargeBudget(e.Result)
+			return e.Result, err
 		}
-		return fmt.Errorf("claude: process exited with code %d", exitErr.ExitCode())
+		return nil, err
+	}
+	var resp Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("claude: failed to parse JSON response: %w", err)
 	}
-	return fmt.Errorf("claude: %w", err)
+	log.apply(&resp)
+	c.chargeBudget(&resp)
+	return &resp, resultError(&resp)
 }
@@ -1,6 +1,8 @@
 package claude
 
 import (
+	"context"
+	"strings"
 	"testing"
 )
 
@@ -125,3 +127,100 @@ func assertArgs(t *testing.T, expected, actual []string) {
 		}
 	}
 }
+
+func TestBuildArgsCLIFlags(t *testing.T) {
+	c := NewClient(
+		WithDisallowedTools("Bash", "Write"),
+		WithPermissionMode(PermissionAcceptEdits),
+		WithAddDirs("../lib", "/data"),
+		WithSettings("settings.json"),
+		WithFallbackModel("sonnet"),
+		WithSessionID("0b7c1e9a-8f4d-4a8e-9f2a-3c1d5e6f7a8b"),
+		WithStrictMCPConfig(),
+		WithVerbose(),
+	)
+	args := c.buildArgs("hello", FormatJSON)
+
+	expected := []string{
+		"-p", "hello",
+		"--output-format", "json",
+		"--disallowedTools", "Bash",
+		"--disallowedTools", "Write",
+		"--permission-mode", "acceptEdits",
+		"--add-dir", "../lib",
+		"--add-dir", "/data",
+		"--settings", "settings.json",
+		"--fallback-model", "sonnet",
+		"--session-id", "0b7c1e9a-8f4d-4a8e-9f2a-3c1d5e6f7a8b",
+		"--strict-mcp-config",
+		"--verbose",
+	}
+	assertArgs(t, expected, args)
+}
+
+func TestBuildArgsVerboseStreamJSON(t *testing.T) {
+	c := NewClient(WithVerbose())
+	args := c.buildArgs("test", FormatStreamJSON)
+
+	expected := []string{"-p", "test", "--output-format", "stream-json", "--verbose", "--include-partial-messages"}
+	assertArgs(t, expected, args)
+}
+
+func TestBuildArgsForkSession(t *testing.T) {
+	c := NewClient(WithForkSession(), WithSessionID("new-id"))
+
+	args := c.buildArgs("more", FormatJSON, "--resume", "old-id")
+	expected := []string{"-p", "more", "--output-format", "json", "--session-id", "new-id", "--fork-session", "--resume", "old-id"}
+	assertArgs(t, expected, args)
+
+	args = c.buildArgs("more", FormatJSON, "--resume", "old-id", "--fork-session")
+	expected = []string{"-p", "more", "--output-format", "json", "--session-id", "new-id", "--resume", "old-id", "--fork-session"}
+	assertArgs(t, expected, args)
+}
+
+func TestBuildArgsSessionIDNotResumed(t *testing.T) {
+	c := NewClient(WithSessionID("new-id"))
+	args := c.buildArgs("more", FormatJSON, "--resume", "new-id")
+
+	expected := []string{"-p", "more", "--output-format", "json", "--resume", "new-id"}
+	assertArgs(t, expected, args)
+}
+
+func TestBuildArgsAgents(t *testing.T) {
+	c := NewClient(WithAgents(map[string]Agent{
+		"reviewer": {Description: "Reviews code", Prompt: "You review code.", Tools: []string{"Read"}},
+	}))
+	args := c.buildArgs("hello", FormatText)
+
+	expected := []string{
+		"-p", "hello",
+		"--output-format", "text",
+		"--agents", `{"reviewer":{"description":"Reviews code","prompt":"You review code.","tools":["Read"]}}`,
+	}
+	assertArgs(t, expected, args)
+}
+
+func TestBuildArgsExtraArgs(t *testing.T) {
+	c := NewClient(WithModel("opus"), WithExtraArgs("--debug", "api"))
+	args := c.buildArgs("hello", FormatJSON, "--continue")
+
+	expected := []string{"-p", "hello", "--output-format", "json", "--model", "opus", "--debug", "api", "--continue"}
+	assertArgs(t, expected, args)
+}
+
+func TestExtraArgsRejectsManagedFlags(t *testing.T) {
+	for _, extra := range [][]string{
+		{"--model", "opus"},
+		{"--output-format=text"},
+		{"--debug", "--resume", "abc"},
+	} {
+		c := NewClient(WithExtraArgs(extra...), WithCLIPath("/nonexistent/claude"))
+		_, err := c.Ask(context.Background(), "hi")
+		if err == nil || !strings.Contains(err.Error(), "WithExtraArgs") {
+			t.Errorf("extra %q: err = %v, want WithExtraArgs error", extra, err)
+		}
+		if _, err := c.Stream(context.Background(), "hi").Result(); err == nil || !strings.Contains(err.Error(), "WithExtraArgs") {
+			t.Errorf("extra %q: stream err = %v, want WithExtraArgs error", extra, err)
+		}
+	}
+}
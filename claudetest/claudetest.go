@@ -0,0 +1,358 @@
+// Package claudetest provides a scriptable fake claude CLI for testing code
+// that uses claude.Client without a real, authenticated CLI.
+//
+// The fake is a small executable built from source embedded in this package
+// (the go command must be on PATH) and is used with claude.WithCLIPath:
+//
+//	cli := claudetest.New(t)
+//	cli.Add(claudetest.Reply{Response: &claude.Response{Result: "4", SessionID: "s1"}})
+//	client := claude.NewClient(claude.WithCLIPath(cli.Path()))
+//
+// Replies are served to -p invocations in the order they were added; each is
+// used once unless Repeat is set. The fake answers in the requested output
+// format and records the arguments and stdin of every invocation, available
+// from Calls.
+package claudetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/shaul1991/claude-go"
+)
+
+//go:embed internal/fakecli/main.go
+var fakeSource []byte
+
+// ExitNoReply is the exit code of the fake when no scripted reply matches.
+const ExitNoReply = 97
+
+// Reply scripts the fake's answer to one invocation.
+type Reply struct {
+	// Match restricts the reply to prompts containing this substring.
+	// An empty Match matches every prompt.
+	Match string
+	// Repeat serves the reply to every matching invocation instead of once.
+	Repeat bool
+
+	// Response is printed for --output-format json. It also provides the
+	// defaults for Text (its Result) and Stream (see StreamLines).
+	Response *claude.Response
+	// Text is printed for --output-format text.
+	Text string
+	// Stream holds the raw stream-json lines printed for --output-format stream-json.
+	Stream []string
+
+	// Delay is waited before any output is written.
+	Delay time.Duration
+	// EventDelay is waited between stream lines, to simulate a slow stream.
+	EventDelay time.Duration
+	// Hang makes the fake block until it is killed, after Delay.
+	Hang bool
+
+	// Stderr is written to standard error after the output.
+	Stderr string
+	// ExitCode is the exit status of the fake.
+	ExitCode int
+}
+
+// Call is a recorded invocation of the fake.
+type Call struct {
+	// Args are the arguments the fake received, excluding the executable.
+	Args []string `json:"args"`
+	// Prompt is the value of the -p flag.
+	Prompt string `json:"prompt"`
+	// Stdin is the data the fake read from standard input.
+	Stdin string `json:"stdin,omitempty"`
+}
+
+// Flag returns the value following the named flag in the call's arguments.
+func (c Call) Flag(name string) (string, bool) {
+	for i, a := range c.Args {
+		if a == name && i+1 < len(c.Args) {
+			return c.Args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// HasFlag reports whether the call's arguments contain name.
+func (c Call) HasFlag(name string) bool {
+	for _, a := range c.Args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CLI is a fake claude executable backed by a temporary directory.
+type CLI struct {
+	t    testing.TB
+	dir  string
+	path string
+
+	mu      sync.Mutex
+	replies []scriptReply
+}
+
+// scriptReply is the form of a Reply read by the fake executable.
+type scriptReply struct {
+	Match      string   `json:"match,omitempty"`
+	Repeat     bool     `json:"repeat,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	JSON       string   `json:"json,omitempty"`
+	Stream     []string `json:"stream,omitempty"`
+	DelayMS    int64    `json:"delay_ms,omitempty"`
+	EventDelay int64    `json:"event_delay_ms,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	Hang       bool     `json:"hang,omitempty"`
+}
+
+// New creates a fake CLI with no replies. The temporary directory is removed
+// when the test ends.
+func New(t testing.TB) *CLI {
+	t.Helper()
+	bin, err := buildFake()
+	if err != nil {
+		t.Fatalf("claudetest: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude")
+	launcher := fmt.Sprintf("#!/bin/sh\nCLAUDETEST_DIR=%s exec %s \"$@\"\n", shellQuote(dir), shellQuote(bin))
+	if err := os.WriteFile(path, []byte(launcher), 0o755); err != nil {
+		t.Fatalf("claudetest: write launcher: %v", err)
+	}
+
+	f := &CLI{t: t, dir: dir, path: path}
+	f.writeScript()
+	return f
+}
+
+// Path returns the path of the fake executable, for claude.WithCLIPath.
+func (f *CLI) Path() string {
+	return f.path
+}
+
+// Client returns a claude.Client using the fake, with opts applied after WithCLIPath.
+func (f *CLI) Client(opts ...claude.Option) *claude.Client {
+	return claude.NewClient(append([]claude.Option{claude.WithCLIPath(f.path)}, opts...)...)
+}
+
+// Add appends replies to the script.
+func (f *CLI) Add(replies ...Reply) *CLI {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range replies {
+		sr, err := r.script()
+		if err != nil {
+			f.t.Fatalf("claudetest: %v", err)
+		}
+		f.replies = append(f.replies, sr)
+	}
+	f.writeScriptLocked()
+	return f
+}
+
+// Calls returns the invocations recorded so far, in order.
+func (f *CLI) Calls() []Call {
+	f.t.Helper()
+	data, err := os.ReadFile(filepath.Join(f.dir, "calls.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		f.t.Fatalf("claudetest: read calls: %v", err)
+	}
+
+	var calls []Call
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 16*1024*1024)
+	for sc.Scan() {
+		var c Call
+		if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+			f.t.Fatalf("claudetest: parse call: %v", err)
+		}
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// LastCall returns the most recent invocation. It fails the test if there is none.
+func (f *CLI) LastCall() Call {
+	f.t.Helper()
+	calls := f.Calls()
+	if len(calls) == 0 {
+		f.t.Fatal("claudetest: no calls recorded")
+	}
+	return calls[len(calls)-1]
+}
+
+func (f *CLI) writeScript() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeScriptLocked()
+}
+
+// writeScriptLocked atomically replaces script.json with the current replies.
+func (f *CLI) writeScriptLocked() {
+	data, err := json.Marshal(map[string]any{"replies": f.replies})
+	if err != nil {
+		f.t.Fatalf("claudetest: encode script: %v", err)
+	}
+	tmp := filepath.Join(f.dir, "script.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		f.t.Fatalf("claudetest: write script: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(f.dir, "script.json")); err != nil {
+		f.t.Fatalf("claudetest: write script: %v", err)
+	}
+}
+
+// script converts r to the form read by the fake, filling in output formats
+// not given explicitly from Response.
+func (r Reply) script() (scriptReply, error) {
+	sr := scriptReply{
+		Match:      r.Match,
+		Repeat:     r.Repeat,
+		Text:       r.Text,
+		Stream:     r.Stream,
+		DelayMS:    r.Delay.Milliseconds(),
+		EventDelay: r.EventDelay.Milliseconds(),
+		Stderr:     r.Stderr,
+		ExitCode:   r.ExitCode,
+		Hang:       r.Hang,
+	}
+	if r.Response != nil {
+		data, err := json.Marshal(r.Response)
+		if err != nil {
+			return sr, fmt.Errorf("encode response: %w", err)
+		}
+		sr.JSON = string(data)
+		if sr.Text == "" {
+			sr.Text = r.Response.Result
+		}
+		if sr.Stream == nil {
+			sr.Stream = StreamLines(r.Response)
+		}
+	}
+	return sr, nil
+}
+
+// StreamLines synthesizes the stream-json lines the CLI would print for resp:
+// a system init event, text deltas for each chunk (or the whole result when
+// no chunks are given), the assistant message and the final result event.
+func StreamLines(resp *claude.Response, chunks ...string) []string {
+	if len(chunks) == 0 && resp.Result != "" {
+		chunks = []string{resp.Result}
+	}
+
+	var lines []string
+	add := func(v any) {
+		data, _ := json.Marshal(v)
+		lines = append(lines, string(data))
+	}
+	streamEvent := func(ev map[string]any) {
+		add(map[string]any{"type": "stream_event", "session_id": resp.SessionID, "event": ev})
+	}
+
+	add(map[string]any{"type": "system", "subtype": "init", "session_id": resp.SessionID, "model": resp.Model})
+	streamEvent(map[string]any{"type": "message_start", "message": map[string]any{
+		"role": "assistant", "model": resp.Model, "content": []any{}, "usage": resp.Usage,
+	}})
+	streamEvent(map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "text", "text": ""}})
+	for _, chunk := range chunks {
+		streamEvent(map[string]any{"type": "content_block_delta", "index": 0, "delta": map[string]any{"type": "text_delta", "text": chunk}})
+	}
+	streamEvent(map[string]any{"type": "content_block_stop", "index": 0})
+	streamEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "end_turn"}, "usage": resp.Usage})
+	streamEvent(map[string]any{"type": "message_stop"})
+	add(map[string]any{"type": "assistant", "session_id": resp.SessionID, "message": map[string]any{
+		"role": "assistant", "model": resp.Model, "content": []any{map[string]any{"type": "text", "text": strings.Join(chunks, "")}},
+	}})
+
+	result := map[string]any{"type": "result", "subtype": "success", "is_error": false}
+	data, _ := json.Marshal(resp)
+	json.Unmarshal(data, &result)
+	add(result)
+	return lines
+}
+
+var (
+	buildOnce sync.Once
+	buildPath string
+	buildErr  error
+)
+
+// buildFake compiles the fake executable once per process. The binary is
+// cached in the user cache directory, keyed by a hash of its source.
+func buildFake() (string, error) {
+	buildOnce.Do(func() {
+		buildPath, buildErr = compileFake()
+	})
+	return buildPath, buildErr
+}
+
+func compileFake() (string, error) {
+	sum := sha256.Sum256(fakeSource)
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	binDir := filepath.Join(cacheDir, "claudetest", hex.EncodeToString(sum[:8]))
+	bin := filepath.Join(binDir, "claude-fake")
+	if _, err := os.Stat(bin); err == nil {
+		return bin, nil
+	}
+
+	src, err := os.MkdirTemp("", "claudetest-src-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(src)
+	if err := os.WriteFile(filepath.Join(src, "main.go"), fakeSource, 0o600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(src, "go.mod"), []byte("module claudetestfake\n\ngo 1.21\n"), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Build to a temporary name and rename, so concurrent test binaries
+	// never observe a partially written executable.
+	tmp := filepath.Join(binDir, fmt.Sprintf("claude-fake.%d.tmp", os.Getpid()))
+	cmd := exec.Command("go", "build", "-o", tmp, ".")
+	cmd.Dir = src
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("build fake CLI: %v\n%s", err, out)
+	}
+	if err := os.Rename(tmp, bin); err != nil {
+		return "", err
+	}
+	return bin, nil
+}
+
+// shellQuote quotes s for use in a POSIX shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
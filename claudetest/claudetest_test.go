@@ -0,0 +1,145 @@
+package claudetest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/shaul1991/claude-go"
+	"github.com/shaul1991/claude-go/claudetest"
+)
+
+func TestTextAndJSONReplies(t *testing.T) {
+	cli := claudetest.New(t)
+	cli.Add(
+		claudetest.Reply{Match: "capital", Text: "Paris"},
+		claudetest.Reply{Response: &claude.Response{Result: "4", SessionID: "s1", Usage: claude.Usage{InputTokens: 3, OutputTokens: 1}}},
+	)
+	client := cli.Client(claude.WithModel("sonnet"))
+
+	text, err := client.Ask(context.Background(), "What is the capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Paris" {
+		t.Errorf("text = %q", text)
+	}
+
+	resp, err := client.AskJSON(context.Background(), "2+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "4" || resp.SessionID != "s1" || resp.Usage.OutputTokens != 1 {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	calls := cli.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(calls))
+	}
+	if calls[1].Prompt != "2+2" {
+		t.Errorf("prompt = %q", calls[1].Prompt)
+	}
+	if model, _ := calls[1].Flag("--model"); model != "sonnet" {
+		t.Errorf("--model = %q", model)
+	}
+	if format, _ := calls[1].Flag("--output-format"); format != "json" {
+		t.Errorf("--output-format = %q", format)
+	}
+}
+
+func TestStreamReply(t *testing.T) {
+	cli := claudetest.New(t)
+	resp := &claude.Response{Result: "Hello world", SessionID: "s1", Model: "claude-sonnet"}
+	cli.Add(claudetest.Reply{Stream: claudetest.StreamLines(resp, "Hello", " world"), EventDelay: time.Millisecond})
+
+	s := cli.Client().Stream(context.Background(), "hi")
+	var text strings.Builder
+	for ev := range s.Events() {
+		typed, err := ev.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, ok := typed.(*claude.ContentBlockDeltaEvent); ok {
+			text.WriteString(d.Delta.Text)
+		}
+	}
+	got, err := s.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.String() != "Hello world" || got.Result != "Hello world" {
+		t.Errorf("deltas = %q, result = %q", text.String(), got.Result)
+	}
+	if got.Model != "claude-sonnet" || got.SessionID != "s1" {
+		t.Errorf("resp = %+v", got)
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	cli := claudetest.New(t)
+	cli.Add(claudetest.Reply{Stderr: "API Error: 429 rate limit exceeded", ExitCode: 1})
+
+	_, err := cli.Client().Ask(context.Background(), "hi")
+	if !errors.Is(err, claude.ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	var cerr *claude.Error
+	if !errors.As(err, &cerr) || cerr.ExitCode != 1 {
+		t.Errorf("err = %#v", err)
+	}
+}
+
+func TestRepliesAreUsedOnce(t *testing.T) {
+	cli := claudetest.New(t)
+	cli.Add(claudetest.Reply{Text: "first"}, claudetest.Reply{Text: "again", Repeat: true})
+	client := cli.Client()
+
+	for _, want := range []string{"first", "again", "again"} {
+		got, err := client.Ask(context.Background(), "hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestNoReply(t *testing.T) {
+	cli := claudetest.New(t)
+	_, err := cli.Client().Ask(context.Background(), "unscripted")
+	var cerr *claude.Error
+	if !errors.As(err, &cerr) || cerr.ExitCode != claudetest.ExitNoReply {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(cerr.Stderr, "unscripted") {
+		t.Errorf("stderr = %q", cerr.Stderr)
+	}
+}
+
+func TestHang(t *testing.T) {
+	cli := claudetest.New(t)
+	cli.Add(claudetest.Reply{Hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := cli.Client().Ask(ctx, "hi")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestPipeRecordsStdin(t *testing.T) {
+	cli := claudetest.New(t)
+	cli.Add(claudetest.Reply{Text: "summary"})
+
+	if _, err := cli.Client().Pipe(context.Background(), strings.NewReader("log line"), "summarize"); err != nil {
+		t.Fatal(err)
+	}
+	if call := cli.LastCall(); call.Stdin != "log line" || call.Prompt != "summarize" {
+		t.Errorf("call = %+v", call)
+	}
+}
@@ -0,0 +1,166 @@
+// Command fakecli is the fake claude executable built by package claudetest.
+// It serves the replies scripted in $CLAUDETEST_DIR/script.json and records
+// every invocation in $CLAUDETEST_DIR/calls.jsonl.
+//
+// It only depends on the standard library so that claudetest can build it
+// from its embedded source outside of any module.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type script struct {
+	Replies []reply `json:"replies"`
+}
+
+type reply struct {
+	Match      string   `json:"match,omitempty"`
+	Repeat     bool     `json:"repeat,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	JSON       string   `json:"json,omitempty"`
+	Stream     []string `json:"stream,omitempty"`
+	DelayMS    int64    `json:"delay_ms,omitempty"`
+	EventDelay int64    `json:"event_delay_ms,omitempty"`
+	Stderr     string   `json:"stderr,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	Hang       bool     `json:"hang,omitempty"`
+}
+
+type call struct {
+	Args   []string `json:"args"`
+	Prompt string   `json:"prompt"`
+	Stdin  string   `json:"stdin,omitempty"`
+}
+
+// exitNoReply is the exit code used when no scripted reply matches.
+const exitNoReply = 97
+
+func main() {
+	dir := os.Getenv("CLAUDETEST_DIR")
+	if dir == "" {
+		fail("CLAUDETEST_DIR is not set")
+	}
+
+	args := os.Args[1:]
+	c := call{Args: args, Prompt: flagValue(args, "-p")}
+	if flagValue(args, "--input-format") == "" {
+		if data, err := io.ReadAll(os.Stdin); err == nil {
+			c.Stdin = string(data)
+		}
+	}
+	record(dir, c)
+
+	var s script
+	data, err := os.ReadFile(filepath.Join(dir, "script.json"))
+	if err != nil {
+		fail("read script: %v", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		fail("parse script: %v", err)
+	}
+
+	r, ok := pick(dir, s.Replies, c.Prompt)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "claudetest: no reply scripted for prompt %q\n", c.Prompt)
+		os.Exit(exitNoReply)
+	}
+	serve(r, flagValue(args, "--output-format"))
+}
+
+// pick returns the first reply matching prompt that has not been used yet.
+// Single-use replies are claimed with an exclusive marker file so that
+// concurrent invocations never serve the same reply twice.
+func pick(dir string, replies []reply, prompt string) (reply, bool) {
+	for i, r := range replies {
+		if r.Match != "" && !strings.Contains(prompt, r.Match) {
+			continue
+		}
+		if r.Repeat {
+			return r, true
+		}
+		marker := filepath.Join(dir, "used-"+strconv.Itoa(i))
+		f, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			fail("claim reply: %v", err)
+		}
+		f.Close()
+		return r, true
+	}
+	return reply{}, false
+}
+
+func serve(r reply, format string) {
+	if r.DelayMS > 0 {
+		time.Sleep(time.Duration(r.DelayMS) * time.Millisecond)
+	}
+	if r.Hang {
+		// Block until the process is killed.
+		time.Sleep(time.Duration(1<<63 - 1))
+	}
+
+	switch format {
+	case "json":
+		if r.JSON != "" {
+			fmt.Println(r.JSON)
+		}
+	case "stream-json":
+		for i, line := range r.Stream {
+			if i > 0 && r.EventDelay > 0 {
+				time.Sleep(time.Duration(r.EventDelay) * time.Millisecond)
+			}
+			fmt.Println(line)
+		}
+	default:
+		if r.Text != "" {
+			fmt.Println(r.Text)
+		}
+	}
+
+	if r.Stderr != "" {
+		fmt.Fprintln(os.Stderr, r.Stderr)
+	}
+	os.Exit(r.ExitCode)
+}
+
+// record appends the call to calls.jsonl with a single write.
+func record(dir string, c call) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		fail("encode call: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "calls.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		fail("record call: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		fail("record call: %v", err)
+	}
+}
+
+// flagValue returns the argument following name, or "".
+func flagValue(args []string, name string) string {
+	for i, a := range args {
+		if a == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "claudetest: "+format+"\n", args...)
+	os.Exit(exitNoReply)
+}
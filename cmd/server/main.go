@@ -28,20 +28,31 @@ func main() {
 	defaultModel := flag.String("model", envOrDefault("CLAUDE_MODEL", "opus"), "default model when not specified in request")
 	maxBudget := flag.Float64("max-budget", 0, "max budget in USD per request")
 	maxTurns := flag.Int("max-turns", 0, "max turns per request")
+	maxConcurrency := flag.Int("max-concurrency", 0, "max CLI calls running at once (0 = unlimited)")
+	maxQueue := flag.Int("max-queue", -1, "max requests waiting when max-concurrency is reached (-1 = unbounded)")
+	poolSize := flag.Int("pool-size", 0, "number of warm CLI processes to keep (0 = no pool)")
+	poolMaxIdle := flag.Duration("pool-max-idle", 0, "stop pooled processes idle for longer than this (0 = 5m)")
+	gracePeriod := flag.Duration("grace-period", 0, "time a cancelled CLI process gets to exit after SIGTERM before SIGKILL (0 = 5s)")
 	flag.Parse()
 
 	config := server.ServerConfig{
-		APIKey:       *apiKey,
-		CLIPath:      *cliPath,
-		WorkDir:      *workDir,
-		DefaultModel: *defaultModel,
-		MaxBudget:    *maxBudget,
-		MaxTurns:     *maxTurns,
+		APIKey:         *apiKey,
+		CLIPath:        *cliPath,
+		WorkDir:        *workDir,
+		DefaultModel:   *defaultModel,
+		MaxBudget:      *maxBudget,
+		MaxTurns:       *maxTurns,
+		MaxConcurrency: *maxConcurrency,
+		MaxQueue:       *maxQueue,
+		PoolSize:       *poolSize,
+		PoolMaxIdle:    *poolMaxIdle,
+		GracePeriod:    *gracePeriod,
 	}
 
+	handler := server.NewServer(config)
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", *host, *port),
-		Handler:      server.NewServer(config),
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 600 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -67,6 +78,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("server shutdown: %v", err)
 	}
+	handler.Close()
 	log.Println("server stopped")
 }
 
@@ -0,0 +1,171 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Turn is a single prompt/response exchange of a Conversation.
+type Turn struct {
+	Prompt    string    `json:"prompt"`
+	Result    string    `json:"result"`
+	SessionID string    `json:"session_id"`
+	Usage     Usage     `json:"usage"`
+	Time      time.Time `json:"time"`
+}
+
+// Conversation is a multi-turn session. It threads the session ID of each
+// response into the next turn and keeps a local transcript.
+// Turns are sent one at a time; concurrent Send calls are serialized.
+type Conversation struct {
+	client *Client
+
+	// turnMu serializes turns; mu guards the fields below.
+	turnMu sync.Mutex
+	mu     sync.Mutex
+
+	sessionID string
+	fork      bool
+	turns     []Turn
+}
+
+// conversationState is the saved form of a Conversation.
+type conversationState struct {
+	SessionID string `json:"session_id"`
+	Fork      bool   `json:"fork,omitempty"`
+	Turns     []Turn `json:"turns"`
+}
+
+// NewConversation starts a new conversation. The first turn starts a new
+// session; later turns resume it.
+func (c *Client) NewConversation() *Conversation {
+	return &Conversation{client: c}
+}
+
+// RestoreConversation recreates a conversation saved with json.Marshal.
+func RestoreConversation(c *Client, data []byte) (*Conversation, error) {
+	var st conversationState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("claude: restore conversation: %w", err)
+	}
+	return &Conversation{
+		client:    c,
+		sessionID: st.SessionID,
+		fork:      st.Fork,
+		turns:     st.Turns,
+	}, nil
+}
+
+// MarshalJSON saves the session ID and transcript so the conversation can be
+// restored with RestoreConversation.
+func (cv *Conversation) MarshalJSON() ([]byte, error) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return json.Marshal(conversationState{
+		SessionID: cv.sessionID,
+		Fork:      cv.fork,
+		Turns:     cv.turns,
+	})
+}
+
+// SessionID returns the session ID of the latest turn, or "" before the first turn.
+func (cv *Conversation) SessionID() string {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return cv.sessionID
+}
+
+// Turns returns a copy of the transcript.
+func (cv *Conversation) Turns() []Turn {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return append([]Turn(nil), cv.turns...)
+}
+
+// Usage returns the total token usage of all turns.
+func (cv *Conversation) Usage() Usage {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	var total Usage
+	for _, t := range cv.turns {
+		total = total.Add(t.Usage)
+	}
+	return total
+}
+
+// Fork returns a copy of the conversation whose next turn branches off into a
+// new session (--fork-session), leaving the original session untouched.
+func (cv *Conversation) Fork() *Conversation {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	return &Conversation{
+		client:    cv.client,
+		sessionID: cv.sessionID,
+		fork:      cv.sessionID != "",
+		turns:     append([]Turn(nil), cv.turns...),
+	}
+}
+
+// Send sends the next prompt and records the turn.
+func (cv *Conversation) Send(ctx context.Context, prompt string, opts ...CallOption) (*Response, error) {
+	cv.turnMu.Lock()
+	defer cv.turnMu.Unlock()
+
+	c := cv.client.forCall(opts)
+	resp, err := c.runJSON(ctx, cv.args(c, prompt, FormatJSON))
+	if resp != nil {
+		cv.record(prompt, resp)
+	}
+	return resp, err
+}
+
+// SendStream sends the next prompt with stream-json output. The turn is
+// recorded when the stream ends with a result event. The next turn waits
+// until this stream has finished.
+func (cv *Conversation) SendStream(ctx context.Context, prompt string, opts ...CallOption) *Stream {
+	cv.turnMu.Lock()
+	c := cv.client.forCall(opts)
+	return c.startStream(ctx, cv.args(c, prompt, FormatStreamJSON), nil, func(resp *Response, err error) (*Response, error) {
+		defer cv.turnMu.Unlock()
+		if resp != nil {
+			cv.record(prompt, resp)
+		}
+		return resp, err
+	})
+}
+
+// args builds the CLI arguments for the next turn, using c's settings.
+func (cv *Conversation) args(c *Client, prompt string, format OutputFormat) []string {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+
+	var extra []string
+	if cv.sessionID != "" {
+		extra = append(extra, "--resume", cv.sessionID)
+		if cv.fork {
+			extra = append(extra, "--fork-session")
+		}
+	}
+	return c.buildArgs(prompt, format, extra...)
+}
+
+// record appends a turn and moves the conversation to the response's session.
+func (cv *Conversation) record(prompt string, resp *Response) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+
+	if resp.SessionID != "" {
+		cv.sessionID = resp.SessionID
+		cv.fork = false
+	}
+	cv.turns = append(cv.turns, Turn{
+		Prompt:    prompt,
+		Result:    resp.Result,
+		SessionID: resp.SessionID,
+		Usage:     resp.Usage,
+		Time:      time.Now(),
+	})
+}
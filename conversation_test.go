@@ -0,0 +1,119 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// conversationCLI returns a fake CLI that logs its arguments to a file and
+// replies with a new session ID per call.
+func conversationCLI(t *testing.T) (cli, argLog string) {
+	t.Helper()
+	dir := t.TempDir()
+	argLog = filepath.Join(dir, "args")
+	cli = writeFakeCLI(t, `echo "$*" >> `+argLog+`
+n=$(wc -l < `+argLog+` | tr -d ' ')
+case "$*" in
+*stream-json*) echo '{"type":"result","subtype":"success","result":"streamed","session_id":"s'$n'","usage":{"input_tokens":1,"output_tokens":1}}' ;;
+*) echo '{"result":"reply'$n'","session_id":"s'$n'","usage":{"input_tokens":2,"output_tokens":3}}' ;;
+esac`)
+	return cli, argLog
+}
+
+func readArgLog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestConversationThreadsSession(t *testing.T) {
+	cli, argLog := conversationCLI(t)
+	conv := NewClient(WithCLIPath(cli)).NewConversation()
+	ctx := context.Background()
+
+	if _, err := conv.Send(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.Send(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := conv.SendStream(ctx, "third").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := readArgLog(t, argLog)
+	if strings.Contains(calls[0], "--resume") {
+		t.Errorf("first turn resumed: %s", calls[0])
+	}
+	if !strings.Contains(calls[1], "--resume s1") || !strings.Contains(calls[2], "--resume s2") {
+		t.Errorf("later turns did not resume previous session: %q", calls[1:])
+	}
+	if resp.SessionID != "s3" || conv.SessionID() != "s3" {
+		t.Errorf("session = %q / %q", resp.SessionID, conv.SessionID())
+	}
+
+	turns := conv.Turns()
+	if len(turns) != 3 || turns[0].Prompt != "first" || turns[2].Result != "streamed" {
+		t.Errorf("turns = %+v", turns)
+	}
+	if got := conv.Usage(); got != (Usage{InputTokens: 5, OutputTokens: 7}) {
+		t.Errorf("usage = %+v", got)
+	}
+}
+
+func TestConversationFork(t *testing.T) {
+	cli, argLog := conversationCLI(t)
+	conv := NewClient(WithCLIPath(cli)).NewConversation()
+	ctx := context.Background()
+
+	conv.Send(ctx, "base")
+	fork := conv.Fork()
+	fork.Send(ctx, "branch")
+	fork.Send(ctx, "branch again")
+
+	calls := readArgLog(t, argLog)
+	if !strings.Contains(calls[1], "--resume s1 --fork-session") {
+		t.Errorf("fork did not use --fork-session: %s", calls[1])
+	}
+	if strings.Contains(calls[2], "--fork-session") {
+		t.Errorf("fork-session repeated after branching: %s", calls[2])
+	}
+	if conv.SessionID() != "s1" || len(conv.Turns()) != 1 {
+		t.Errorf("original conversation changed: %q, %d turns", conv.SessionID(), len(conv.Turns()))
+	}
+	if len(fork.Turns()) != 3 {
+		t.Errorf("fork turns = %d", len(fork.Turns()))
+	}
+}
+
+func TestConversationSaveRestore(t *testing.T) {
+	cli, argLog := conversationCLI(t)
+	c := NewClient(WithCLIPath(cli))
+	conv := c.NewConversation()
+	conv.Send(context.Background(), "hello")
+
+	data, err := json.Marshal(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreConversation(c, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.SessionID() != "s1" || len(restored.Turns()) != 1 {
+		t.Fatalf("restored = %q, %+v", restored.SessionID(), restored.Turns())
+	}
+
+	restored.Send(context.Background(), "again")
+	if calls := readArgLog(t, argLog); !strings.Contains(calls[1], "--resume s1") {
+		t.Errorf("restored conversation did not resume: %s", calls[1])
+	}
+}
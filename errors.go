@@ -0,0 +1,223 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// ErrorKind classifies why a CLI invocation failed.
+type ErrorKind string
+
+const (
+	KindUnknown       ErrorKind = "unknown"
+	KindNotFound      ErrorKind = "not_found"
+	KindAuth          ErrorKind = "auth"
+	KindRateLimit     ErrorKind = "rate_limit"
+	KindOverloaded    ErrorKind = "overloaded"
+	KindNetwork       ErrorKind = "network"
+	KindBudget        ErrorKind = "budget"
+	KindMaxTurns      ErrorKind = "max_turns"
+	KindCanceled      ErrorKind = "canceled"
+	KindResourceLimit ErrorKind = "resource_limit"
+)
+
+// Sentinel errors matched by errors.Is against an *Error of the corresponding kind.
+var (
+	ErrCLINotFound    = errors.New("claude: CLI not found")
+	ErrAuth           = errors.New("claude: authentication failed")
+	ErrRateLimited    = errors.New("claude: rate limited")
+	ErrOverloaded     = errors.New("claude: API overloaded")
+	ErrNetwork        = errors.New("claude: network error")
+	ErrBudgetExceeded = errors.New("claude: budget exceeded")
+	ErrMaxTurns       = errors.New("claude: max turns reached")
+	ErrCanceled       = errors.New("claude: canceled")
+	ErrResourceLimit  = errors.New("claude: resource limit exceeded")
+)
+
+var kindSentinels = map[ErrorKind]error{
+	KindNotFound:      ErrCLINotFound,
+	KindAuth:          ErrAuth,
+	KindRateLimit:     ErrRateLimited,
+	KindOverloaded:    ErrOverloaded,
+	KindNetwork:       ErrNetwork,
+	KindBudget:        ErrBudgetExceeded,
+	KindMaxTurns:      ErrMaxTurns,
+	KindCanceled:      ErrCanceled,
+	KindResourceLimit: ErrResourceLimit,
+}
+
+// Error describes a failed CLI invocation. Use errors.As to inspect it, or
+// errors.Is with one of the sentinel errors (ErrAuth, ErrRateLimited, ...) to
+// test its kind. Cancellation errors also match context.Canceled and
+// context.DeadlineExceeded.
+type Error struct {
+	// Kind is the classified failure reason.
+	Kind ErrorKind
+	// ExitCode is the process exit code, or -1 if the process did not exit
+	// normally (not started, killed by a signal).
+	ExitCode int
+	// Stderr is the trimmed standard error output of the process.
+	Stderr string
+	// Err is the underlying error.
+	Err error
+	// Result is the CLI's result when it reported the run as failed
+	// (is_error), whether or not the process exited with an error.
+	Result *Response
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Kind == KindCanceled || e.Kind == KindNotFound || e.Kind == KindResourceLimit:
+		return fmt.Sprintf("%v: %v", kindSentinels[e.Kind], e.Err)
+	case e.Result != nil && e.Result.Result != "":
+		return fmt.Sprintf("claude: run failed (%s): %s", e.Result.Subtype, e.Result.Result)
+	case e.Result != nil:
+		return fmt.Sprintf("claude: run failed (%s)", e.Result.Subtype)
+	case e.ExitCode >= 0 && e.Stderr != "":
+		return fmt.Sprintf("claude: process exited with code %d: %s", e.ExitCode, e.Stderr)
+	case e.ExitCode >= 0:
+		return fmt.Sprintf("claude: process exited with code %d", e.ExitCode)
+	case e.Stderr != "":
+		return fmt.Sprintf("claude: %v: %s", e.Err, e.Stderr)
+	default:
+		return fmt.Sprintf("claude: %v", e.Err)
+	}
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error for e.Kind.
+func (e *Error) Is(target error) bool {
+	sentinel, ok := kindSentinels[e.Kind]
+	return ok && target == sentinel
+}
+
+// newError builds a classified *Error from a process error and its output.
+func newError(ctx context.Context, err error, stderr, stdout string) *Error {
+	e := &Error{
+		Kind:     KindUnknown,
+		ExitCode: -1,
+		Stderr:   strings.TrimSpace(stderr),
+		Err:      err,
+	}
+
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		e.ExitCode = coder.ExitCode()
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// The process was killed because the context ended; report that
+		// rather than the resulting "signal: killed". A *TerminatedError
+		// already does and also names the signal.
+		e.Kind = KindCanceled
+		var terr *TerminatedError
+		if !errors.As(err, &terr) {
+			e.Err = ctx.Err()
+		}
+	case errors.As(err, new(*LimitError)):
+		e.Kind = KindResourceLimit
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		e.Kind = KindCanceled
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+		e.Kind = KindNotFound
+	default:
+		e.Kind = classifyOutput(e.Stderr, stderrPatterns)
+		if resp := parseFailedResult(stdout); resp != nil {
+			e.Result = resp
+			if kind := resp.errorKind(); kind != KindUnknown {
+				e.Kind = kind
+			}
+		}
+	}
+	return e
+}
+
+// resultError returns the error for a result the CLI reported as failed, or
+// nil if resp is a success.
+func resultError(resp *Response) error {
+	if resp == nil || !resp.IsError {
+		return nil
+	}
+	return &Error{
+		Kind:     resp.errorKind(),
+		ExitCode: 0,
+		Err:      fmt.Errorf("run failed: %s", resp.Subtype),
+		Result:   resp,
+	}
+}
+
+// errorKind classifies a failed result by its subtype, or by the API error
+// its text reports.
+func (r *Response) errorKind() ErrorKind {
+	switch r.Subtype {
+	case ResultErrorMaxTurns:
+		return KindMaxTurns
+	case ResultErrorMaxBudget:
+		return KindBudget
+	}
+	return classifyOutput(r.Result, resultPatterns)
+}
+
+// parseFailedResult parses the JSON result in the stdout of a failed process,
+// if it reports an error.
+func parseFailedResult(stdout string) *Response {
+	stdout = strings.TrimSpace(stdout)
+	if !strings.HasPrefix(stdout, "{") {
+		return nil
+	}
+	var resp Response
+	if err := json.Unmarshal([]byte(stdout), &resp); err != nil || !resp.IsError {
+		return nil
+	}
+	return &resp
+}
+
+// outputPattern maps lower-cased substrings of CLI output to an error kind.
+type outputPattern struct {
+	kind     ErrorKind
+	patterns []string
+}
+
+// stderrPatterns classify the standard error of a failed process. Status
+// codes are only matched together with the words the CLI prints around
+// them. The first matching kind wins, so more specific kinds come first.
+var stderrPatterns = []outputPattern{
+	{KindAuth, []string{"invalid api key", "authentication_error", "authentication failed", "unauthorized", "/login", "not logged in", "oauth token", "api error: 401", "status 401"}},
+	{KindRateLimit, []string{"rate limit", "rate_limit", "too many requests", "api error: 429", "status 429"}},
+	{KindOverloaded, []string{"overloaded", "api error: 529", "status 529"}},
+	{KindBudget, []string{"usd budget", "max-budget-usd", "budget exceeded"}},
+	{KindMaxTurns, []string{"max turns", "max_turns", "maximum number of turns"}},
+	{KindNetwork, []string{"econnreset", "econnrefused", "enotfound", "etimedout", "eai_again", "socket hang up", "fetch failed", "network error", "connection error"}},
+}
+
+// resultPatterns classify the text of a failed result. The text can quote
+// the model's answer, so only the API error messages the CLI reports there
+// are matched.
+var resultPatterns = []outputPattern{
+	{KindAuth, []string{"invalid api key", "please run /login", "authentication_error", "api error: 401"}},
+	{KindRateLimit, []string{"rate_limit_error", "api error: 429"}},
+	{KindOverloaded, []string{"overloaded_error", "api error: 529"}},
+}
+
+// classifyOutput guesses the failure kind from the CLI's output.
+func classifyOutput(output string, patterns []outputPattern) ErrorKind {
+	lower := strings.ToLower(output)
+	for _, p := range patterns {
+		for _, s := range p.patterns {
+			if strings.Contains(lower, s) {
+				return p.kind
+			}
+		}
+	}
+	return KindUnknown
+}
@@ -0,0 +1,139 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   ErrorKind
+	}{
+		{"Invalid API key · Please run /login", KindAuth},
+		{"API Error: 429 rate_limit_error", KindRateLimit},
+		{"API Error: 529 {\"type\":\"overloaded_error\"}", KindOverloaded},
+		{"Error: Exceeded USD budget (1)", KindBudget},
+		{"Error: Reached max turns (3)", KindMaxTurns},
+		{"request failed: ECONNRESET", KindNetwork},
+		{"something else", KindUnknown},
+		{"failed after 401 attempts", KindUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyOutput(tt.output, stderrPatterns); got != tt.want {
+			t.Errorf("classifyOutput(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestErrorIgnoresModelText(t *testing.T) {
+	cli := writeFakeCLI(t, `echo 'The budget returned 401 and 429 errors.'; echo 'boom' >&2; exit 1`)
+	_, err := NewClient(WithCLIPath(cli)).Ask(context.Background(), "hi")
+	var cerr *Error
+	if !errors.As(err, &cerr) || cerr.Kind != KindUnknown {
+		t.Errorf("err = %v, want KindUnknown", err)
+	}
+
+	resp := &Response{Subtype: ResultErrorDuringExecution, IsError: true, Result: "Your budget is fine, but the 401 page is broken."}
+	if kind := resp.errorKind(); kind != KindUnknown {
+		t.Errorf("errorKind() = %q, want %q", kind, KindUnknown)
+	}
+}
+
+func TestErrorExitCodeAndStderr(t *testing.T) {
+	cli := writeFakeCLI(t, `echo "API Error: 429 Too Many Requests" >&2; exit 1`)
+	c := NewClient(WithCLIPath(cli))
+
+	_, err := c.Ask(context.Background(), "hi")
+	var cerr *Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if cerr.ExitCode != 1 || cerr.Stderr != "API Error: 429 Too Many Requests" {
+		t.Errorf("err = %+v", cerr)
+	}
+	if !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrAuth) {
+		t.Errorf("errors.Is mismatch for kind %q", cerr.Kind)
+	}
+	if want := "claude: process exited with code 1: API Error: 429 Too Many Requests"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestErrorNotFound(t *testing.T) {
+	c := NewClient(WithCLIPath("/nonexistent/claude"))
+
+	_, err := c.AskJSON(context.Background(), "hi")
+	if !errors.Is(err, ErrCLINotFound) {
+		t.Errorf("err = %v, want ErrCLINotFound", err)
+	}
+
+	_, err = c.Stream(context.Background(), "hi").Result()
+	if !errors.Is(err, ErrCLINotFound) {
+		t.Errorf("stream err = %v, want ErrCLINotFound", err)
+	}
+}
+
+func TestErrorCanceled(t *testing.T) {
+	cli := writeFakeCLI(t, `exec sleep 10`)
+	c := NewClient(WithCLIPath(cli))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Ask(ctx, "hi")
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrCanceled wrapping context.DeadlineExceeded", err)
+	}
+}
+
+func TestAskJSONResultError(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":3,"session_id":"s1","total_cost_usd":0.02}`)
+		return nil
+	})
+	resp, err := NewClient(WithRunner(r)).AskJSON(context.Background(), "hi")
+	var cerr *Error
+	if !errors.Is(err, ErrMaxTurns) || !errors.As(err, &cerr) || cerr.Result != resp {
+		t.Fatalf("err = %v", err)
+	}
+	if resp == nil || resp.NumTurns != 3 || resp.SessionID != "s1" || resp.TotalCostUSD != 0.02 {
+		t.Errorf("resp = %+v", resp)
+	}
+	if want := "claude: run failed (error_max_turns)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestErrorResultFromFailedProcess(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"type":"result","subtype":"error_during_execution","is_error":true,"result":"Invalid API key","session_id":"s1"}'; exit 1`)
+	c := NewClient(WithCLIPath(cli))
+
+	resp, err := c.AskJSON(context.Background(), "hi")
+	var cerr *Error
+	if !errors.Is(err, ErrAuth) || !errors.As(err, &cerr) || cerr.ExitCode != 1 || cerr.Result == nil {
+		t.Fatalf("err = %v", err)
+	}
+	if resp == nil || resp.SessionID != "s1" {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	resp, err = c.Stream(context.Background(), "hi").Result()
+	if !errors.Is(err, ErrAuth) || resp == nil || resp.Subtype != ResultErrorDuringExecution {
+		t.Errorf("stream: resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestStreamResultError(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"error_max_budget_usd","is_error":true,"session_id":"s1"}`+"\n")
+		return nil
+	})
+	resp, err := NewClient(WithRunner(r)).Stream(context.Background(), "hi").Result()
+	if !errors.Is(err, ErrBudgetExceeded) || resp == nil || resp.Subtype != ResultErrorMaxBudget {
+		t.Errorf("resp = %+v, err = %v", resp, err)
+	}
+}
@@ -0,0 +1,282 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TypedEvent is implemented by every decoded stream event type returned by
+// StreamEvent.Decode. Use a type switch to handle the events you care about.
+type TypedEvent interface {
+	EventType() string
+}
+
+// SystemInitEvent is emitted once at the start of a run ("system"/"init").
+type SystemInitEvent struct {
+	SessionID      string   `json:"session_id"`
+	Model          string   `json:"model"`
+	CWD            string   `json:"cwd"`
+	Tools          []string `json:"tools"`
+	PermissionMode string   `json:"permissionMode"`
+	APIKeySource   string   `json:"apiKeySource"`
+	// MCPServers reports the connection status of each configured MCP server.
+	MCPServers []MCPServerStatus `json:"mcp_servers"`
+}
+
+// MessageStartEvent marks the start of an assistant message.
+type MessageStartEvent struct {
+	Message Message `json:"message"`
+}
+
+// ContentBlockStartEvent marks the start of a content block within a message.
+type ContentBlockStartEvent struct {
+	Index        int          `json:"index"`
+	ContentBlock ContentBlock `json:"content_block"`
+}
+
+// ContentBlockDeltaEvent carries an incremental update to a content block.
+type ContentBlockDeltaEvent struct {
+	Index int   `json:"index"`
+	Delta Delta `json:"delta"`
+}
+
+// ContentBlockStopEvent marks the end of a content block.
+type ContentBlockStopEvent struct {
+	Index int `json:"index"`
+}
+
+// MessageDeltaEvent carries top-level message changes such as the stop reason.
+type MessageDeltaEvent struct {
+	Delta MessageDelta `json:"delta"`
+	Usage Usage        `json:"usage"`
+}
+
+// MessageStopEvent marks the end of an assistant message.
+type MessageStopEvent struct{}
+
+// AssistantEvent is a complete assistant message, emitted after streaming of
+// the message has finished. Tool calls made by the agent appear here.
+type AssistantEvent struct {
+	SessionID       string  `json:"session_id"`
+	ParentToolUseID string  `json:"parent_tool_use_id"`
+	Message         Message `json:"message"`
+}
+
+// UserEvent is a user turn injected by the CLI, typically carrying tool results.
+type UserEvent struct {
+	SessionID       string  `json:"session_id"`
+	ParentToolUseID string  `json:"parent_tool_use_id"`
+	Message         Message `json:"message"`
+}
+
+// ToolUseEvent describes a tool invocation requested by the agent. It is not
+// a TypedEvent: the CLI reports tool uses as blocks of an assistant message,
+// and only AssistantEvent.ToolUses returns them.
+type ToolUseEvent struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// ToolResultEvent describes the result of a tool invocation. It is not a
+// TypedEvent: the CLI reports tool results as blocks of a user message, and
+// only UserEvent.ToolResults returns them.
+type ToolResultEvent struct {
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// ResultEvent is the final event of a run and carries the same data as the
+// Response returned by AskJSON.
+type ResultEvent struct {
+	Response
+}
+
+// UnknownEvent is returned for event types this package does not model.
+type UnknownEvent struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// Message is an assistant or user message as reported by the CLI.
+type Message struct {
+	ID           string         `json:"id"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      MessageContent `json:"content"`
+	StopReason   string         `json:"stop_reason"`
+	StopSequence string         `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+// MessageContent is a list of content blocks. A plain string content is
+// decoded as a single text block.
+type MessageContent []ContentBlock
+
+// UnmarshalJSON accepts either a string or an array of content blocks.
+func (mc *MessageContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*mc = MessageContent{{Type: "text", Text: s}}
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*mc = blocks
+	return nil
+}
+
+// ContentBlock is a single block of message content. Which fields are set
+// depends on Type ("text", "thinking", "tool_use", "tool_result").
+type ContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// Delta is the payload of a content_block_delta event. Which field is set
+// depends on Type ("text_delta", "input_json_delta", "thinking_delta", "signature_delta").
+type Delta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+// MessageDelta is the payload of a message_delta event.
+type MessageDelta struct {
+	StopReason   string `json:"stop_reason"`
+	StopSequence string `json:"stop_sequence"`
+}
+
+func (*SystemInitEvent) EventType() string        { return "system" }
+func (*MessageStartEvent) EventType() string      { return "message_start" }
+func (*ContentBlockStartEvent) EventType() string { return "content_block_start" }
+func (*ContentBlockDeltaEvent) EventType() string { return "content_block_delta" }
+func (*ContentBlockStopEvent) EventType() string  { return "content_block_stop" }
+func (*MessageDeltaEvent) EventType() string      { return "message_delta" }
+func (*MessageStopEvent) EventType() string       { return "message_stop" }
+func (*AssistantEvent) EventType() string         { return "assistant" }
+func (*UserEvent) EventType() string              { return "user" }
+func (*ResultEvent) EventType() string            { return "result" }
+func (e *UnknownEvent) EventType() string         { return e.Type }
+
+// Text returns the concatenated text blocks of the message.
+func (e *AssistantEvent) Text() string {
+	var b strings.Builder
+	for _, block := range e.Message.Content {
+		if block.Type == "text" {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+// ToolUses returns the tool invocations contained in the message.
+func (e *AssistantEvent) ToolUses() []ToolUseEvent {
+	var uses []ToolUseEvent
+	for _, block := range e.Message.Content {
+		if block.Type == "tool_use" {
+			uses = append(uses, ToolUseEvent{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	return uses
+}
+
+// ToolResults returns the tool results contained in the message.
+func (e *UserEvent) ToolResults() []ToolResultEvent {
+	var results []ToolResultEvent
+	for _, block := range e.Message.Content {
+		if block.Type == "tool_result" {
+			results = append(results, ToolResultEvent{ToolUseID: block.ToolUseID, Content: block.Content, IsError: block.IsError})
+		}
+	}
+	return results
+}
+
+// errNoRawPayload is returned by Decode for events that were not produced by
+// the stream reader and therefore carry no raw line.
+var errNoRawPayload = errors.New("claude: stream event has no raw payload")
+
+// Decode converts the event into its typed representation. Events of type
+// "stream_event" decode to the Messages API event carried in Event; all other
+// events decode from the raw stream line. Unrecognized events are returned as
+// *UnknownEvent.
+func (e StreamEvent) Decode() (TypedEvent, error) {
+	if e.Type == "stream_event" {
+		return decodeAPIEvent(e.Event)
+	}
+	if len(e.Raw) == 0 {
+		return nil, errNoRawPayload
+	}
+
+	var out TypedEvent
+	switch {
+	case e.Type == "system" && e.Subtype == "init":
+		out = &SystemInitEvent{}
+	case e.Type == "assistant":
+		out = &AssistantEvent{}
+	case e.Type == "user":
+		out = &UserEvent{}
+	case e.Type == "result":
+		out = &ResultEvent{}
+	case e.Type == "tool_call":
+		out = &ToolCallEvent{}
+	case e.Type == "tool_call_result":
+		out = &ToolCallResultEvent{}
+	default:
+		return &UnknownEvent{Type: e.Type, Raw: e.Raw}, nil
+	}
+	if err := json.Unmarshal(e.Raw, out); err != nil {
+		return nil, fmt.Errorf("claude: decode %s event: %w", e.Type, err)
+	}
+	return out, nil
+}
+
+// decodeAPIEvent decodes the Messages API event nested in a "stream_event" line.
+func decodeAPIEvent(raw json.RawMessage) (TypedEvent, error) {
+	if len(raw) == 0 {
+		return nil, errNoRawPayload
+	}
+
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, fmt.Errorf("claude: decode stream event: %w", err)
+	}
+
+	var out TypedEvent
+	switch head.Type {
+	case "message_start":
+		out = &MessageStartEvent{}
+	case "content_block_start":
+		out = &ContentBlockStartEvent{}
+	case "content_block_delta":
+		out = &ContentBlockDeltaEvent{}
+	case "content_block_stop":
+		out = &ContentBlockStopEvent{}
+	case "message_delta":
+		out = &MessageDeltaEvent{}
+	case "message_stop":
+		return &MessageStopEvent{}, nil
+	default:
+		return &UnknownEvent{Type: head.Type, Raw: raw}, nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, fmt.Errorf("claude: decode %s event: %w", head.Type, err)
+	}
+	return out, nil
+}
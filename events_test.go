@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func parseEvent(t *testing.T, line string) StreamEvent {
+	t.Helper()
+	var ev StreamEvent
+	if err := json.Unmarshal([]byte(line), &ev); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	ev.Raw = json.RawMessage(line)
+	return ev
+}
+
+func TestDecodeSystemInit(t *testing.T) {
+	ev := parseEvent(t, `{"type":"system","subtype":"init","session_id":"s1","model":"sonnet","cwd":"/tmp","tools":["Bash","Read"]}`)
+	typed, err := ev.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initEv, ok := typed.(*SystemInitEvent)
+	if !ok {
+		t.Fatalf("expected *SystemInitEvent, got %T", typed)
+	}
+	if initEv.SessionID != "s1" || initEv.Model != "sonnet" || len(initEv.Tools) != 2 {
+		t.Errorf("init = %+v", initEv)
+	}
+}
+
+func TestDecodeStreamEvents(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`{"type":"stream_event","event":{"type":"message_start","message":{"id":"m1","role":"assistant","content":[]}}}`, "message_start"},
+		{`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}}`, "content_block_start"},
+		{`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}}`, "content_block_delta"},
+		{`{"type":"stream_event","event":{"type":"content_block_stop","index":0}}`, "content_block_stop"},
+		{`{"type":"stream_event","event":{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}}`, "message_delta"},
+		{`{"type":"stream_event","event":{"type":"message_stop"}}`, "message_stop"},
+		{`{"type":"stream_event","event":{"type":"ping"}}`, "ping"},
+	}
+	for _, tt := range tests {
+		typed, err := parseEvent(t, tt.line).Decode()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.want, err)
+		}
+		if typed.EventType() != tt.want {
+			t.Errorf("EventType() = %q, want %q", typed.EventType(), tt.want)
+		}
+	}
+
+	typed, _ := parseEvent(t, tests[2].line).Decode()
+	delta := typed.(*ContentBlockDeltaEvent)
+	if delta.Delta.Type != "text_delta" || delta.Delta.Text != "Hi" {
+		t.Errorf("delta = %+v", delta.Delta)
+	}
+}
+
+func TestDecodeToolUseAndResult(t *testing.T) {
+	ev := parseEvent(t, `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Listing."},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}]}}`)
+	typed, err := ev.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assistant := typed.(*AssistantEvent)
+	if assistant.Text() != "Listing." {
+		t.Errorf("Text() = %q", assistant.Text())
+	}
+	uses := assistant.ToolUses()
+	if len(uses) != 1 || uses[0].Name != "Bash" || string(uses[0].Input) != `{"command":"ls"}` {
+		t.Errorf("ToolUses() = %+v", uses)
+	}
+
+	ev = parseEvent(t, `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"a.go","is_error":false}]}}`)
+	typed, err = ev.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := typed.(*UserEvent).ToolResults()
+	if len(results) != 1 || results[0].ToolUseID != "t1" || string(results[0].Content) != `"a.go"` {
+		t.Errorf("ToolResults() = %+v", results)
+	}
+}
+
+func TestDecodeResult(t *testing.T) {
+	ev := parseEvent(t, `{"type":"result","subtype":"success","is_error":false,"num_turns":2,"result":"done","session_id":"s1","total_cost_usd":0.01,"usage":{"input_tokens":10,"output_tokens":5}}`)
+	typed, err := ev.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := typed.(*ResultEvent)
+	if res.Subtype != "success" || res.NumTurns != 2 || res.Result != "done" || res.SessionID != "s1" {
+		t.Errorf("result = %+v", res)
+	}
+	if res.Usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v", res.Usage)
+	}
+}
+
+func TestResponseFullResult(t *testing.T) {
+	data := `{"type":"result","subtype":"success","is_error":false,"duration_ms":2400,"duration_api_ms":2100,
+		"num_turns":1,"result":"hi","session_id":"s1","total_cost_usd":0.0125,
+		"usage":{"input_tokens":4,"cache_creation_input_tokens":1200,"cache_read_input_tokens":9000,"output_tokens":12},
+		"modelUsage":{"claude-sonnet-4-5":{"inputTokens":4,"outputTokens":12,"cacheReadInputTokens":9000,"cacheCreationInputTokens":1200,"webSearchRequests":0,"costUSD":0.0125,"contextWindow":200000}},
+		"permission_denials":[{"tool_name":"Bash","tool_use_id":"t1","tool_input":{"command":"rm -rf /"}}]}`
+	var resp Response
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Subtype != ResultSuccess || resp.DurationAPI != 2100 || resp.NumTurns != 1 || resp.TotalCostUSD != 0.0125 {
+		t.Errorf("resp = %+v", resp)
+	}
+	if resp.Usage.CacheCreationInputTokens != 1200 || resp.Usage.CacheReadInputTokens != 9000 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+	if mu := resp.ModelUsage["claude-sonnet-4-5"]; mu.CostUSD != 0.0125 || mu.CacheReadInputTokens != 9000 || mu.ContextWindow != 200000 {
+		t.Errorf("model usage = %+v", resp.ModelUsage)
+	}
+	if len(resp.PermissionDenials) != 1 || resp.PermissionDenials[0].ToolName != "Bash" || resp.PermissionDenials[0].ToolUseID != "t1" {
+		t.Errorf("permission denials = %+v", resp.PermissionDenials)
+	}
+	if resp.Cost.TotalUSD != 0.0125 || resp.Cost.CacheReadTokens != 9000 {
+		t.Errorf("deprecated cost = %+v", resp.Cost)
+	}
+
+	// Older CLI versions report the cost as cost_usd.
+	var legacy Response
+	if err := json.Unmarshal([]byte(`{"result":"hi","cost_usd":0.5}`), &legacy); err != nil || legacy.TotalCostUSD != 0.5 {
+		t.Errorf("legacy cost: %+v, %v", legacy, err)
+	}
+}
+
+func TestDecodeWithoutRaw(t *testing.T) {
+	if _, err := (StreamEvent{Type: "assistant"}).Decode(); err == nil {
+		t.Error("expected error for event without raw payload")
+	}
+}
@@ -0,0 +1,198 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// HookEvent is a point in the agent's lifecycle at which the CLI runs hooks.
+type HookEvent string
+
+const (
+	HookPreToolUse       HookEvent = "PreToolUse"
+	HookPostToolUse      HookEvent = "PostToolUse"
+	HookStop             HookEvent = "Stop"
+	HookUserPromptSubmit HookEvent = "UserPromptSubmit"
+)
+
+// HookInput holds the fields the CLI sends with every hook.
+type HookInput struct {
+	SessionID      string    `json:"session_id"`
+	TranscriptPath string    `json:"transcript_path"`
+	CWD            string    `json:"cwd"`
+	HookEventName  HookEvent `json:"hook_event_name"`
+	PermissionMode string    `json:"permission_mode,omitempty"`
+}
+
+// PreToolUseInput is the payload of a PreToolUse hook, sent before a tool runs.
+type PreToolUseInput struct {
+	HookInput
+	ToolName  string          `json:"tool_name"`
+	ToolInput json.RawMessage `json:"tool_input"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+}
+
+// PostToolUseInput is the payload of a PostToolUse hook, sent after a tool
+// has completed successfully.
+type PostToolUseInput struct {
+	HookInput
+	ToolName     string          `json:"tool_name"`
+	ToolInput    json.RawMessage `json:"tool_input"`
+	ToolResponse json.RawMessage `json:"tool_response"`
+	ToolUseID    string          `json:"tool_use_id,omitempty"`
+}
+
+// StopInput is the payload of a Stop hook, sent when the agent is about to
+// finish its response.
+type StopInput struct {
+	HookInput
+	// StopHookActive is true when the agent is already continuing because a
+	// Stop hook blocked it. Check it to avoid keeping the agent running forever.
+	StopHookActive bool `json:"stop_hook_active"`
+}
+
+// UserPromptSubmitInput is the payload of a UserPromptSubmit hook, sent
+// before the agent processes a prompt.
+type UserPromptSubmitInput struct {
+	HookInput
+	Prompt string `json:"prompt"`
+}
+
+// HookDecision is the decision a hook handler takes.
+type HookDecision string
+
+const (
+	// HookBlock blocks the action: the tool call for PreToolUse, the prompt
+	// for UserPromptSubmit and stopping for Stop. For PostToolUse the tool has
+	// already run; Reason is shown to the agent as feedback.
+	HookBlock HookDecision = "block"
+	// HookApprove allows a PreToolUse tool call without a permission prompt.
+	// It has no effect on other events.
+	HookApprove HookDecision = "approve"
+)
+
+// HookResult is the answer of a hook handler. The zero HookResult lets the
+// CLI proceed as if there were no hook.
+type HookResult struct {
+	Decision HookDecision
+	// Reason explains the decision. When blocking, it is shown to the agent:
+	// for Stop it should tell the agent how to continue.
+	Reason string
+	// AdditionalContext is added to the agent's context. It applies to
+	// PreToolUse, PostToolUse and UserPromptSubmit.
+	AdditionalContext string
+}
+
+// Hook is a Go handler for a CLI hook. Create one with PreToolUseHook,
+// PostToolUseHook, StopHook or UserPromptSubmitHook and register it with
+// WithHooks.
+type Hook struct {
+	Event HookEvent
+	// Matcher selects the tools a PreToolUse or PostToolUse hook applies to,
+	// e.g. "Bash" or "Edit|Write". It is a regular expression matched by the
+	// CLI; empty matches every tool.
+	Matcher string
+	// Timeout is how long the CLI waits for the handler. Zero uses the CLI
+	// default of 60 seconds.
+	Timeout time.Duration
+
+	handle func(ctx context.Context, payload json.RawMessage) (HookResult, error)
+}
+
+// newHook returns a Hook calling fn with the payload decoded into In.
+func newHook[In any](event HookEvent, matcher string, fn func(context.Context, In) HookResult) Hook {
+	return Hook{
+		Event:   event,
+		Matcher: matcher,
+		handle: func(ctx context.Context, payload json.RawMessage) (HookResult, error) {
+			var in In
+			if err := json.Unmarshal(payload, &in); err != nil {
+				return HookResult{}, fmt.Errorf("decode %s payload: %w", event, err)
+			}
+			return fn(ctx, in), nil
+		},
+	}
+}
+
+// PreToolUseHook returns a hook run before the tools matched by matcher.
+// Blocking denies the tool call and tells the agent why; approving skips
+// the permission prompt.
+func PreToolUseHook(matcher string, fn func(ctx context.Context, in PreToolUseInput) HookResult) Hook {
+	return newHook(HookPreToolUse, matcher, fn)
+}
+
+// PostToolUseHook returns a hook run after the tools matched by matcher
+// have completed successfully.
+func PostToolUseHook(matcher string, fn func(ctx context.Context, in PostToolUseInput) HookResult) Hook {
+	return newHook(HookPostToolUse, matcher, fn)
+}
+
+// StopHook returns a hook run when the agent is about to finish. Blocking
+// makes the agent continue with Reason as its instruction.
+func StopHook(fn func(ctx context.Context, in StopInput) HookResult) Hook {
+	return newHook(HookStop, "", fn)
+}
+
+// UserPromptSubmitHook returns a hook run when a prompt is submitted, before
+// the agent processes it. Blocking rejects the prompt.
+func UserPromptSubmitHook(fn func(ctx context.Context, in UserPromptSubmitInput) HookResult) Hook {
+	return newHook(HookUserPromptSubmit, "", fn)
+}
+
+// WithHooks registers Go handlers for CLI hooks. For each call, the library
+// listens on a Unix socket in a private temporary directory and passes the
+// CLI a settings file whose hook commands forward the payload to it with
+// curl, which must be on PATH. Settings given with WithSettings are merged
+// into that file.
+//
+// The CLI must run on this host to reach the socket and curl, so calls fail
+// unless the client's Runner is a LocalRunner such as ExecRunner; a
+// PrefixRunner sandbox, for example, is rejected.
+//
+// PreToolUse hooks fail closed: if the handler cannot be reached, the tool
+// call is blocked with an explanation. Other hooks fail open, as the CLI
+// treats hook errors.
+func WithHooks(hooks ...Hook) Option {
+	return func(c *Client) {
+		c.hooks = append(slices.Clip(c.hooks), hooks...)
+	}
+}
+
+// hookOutput encodes res in the JSON format the CLI expects from a hook
+// command for event. It returns nil if there is nothing to report.
+func hookOutput(event HookEvent, res HookResult) map[string]any {
+	out := map[string]any{}
+	specific := map[string]any{}
+
+	switch event {
+	case HookPreToolUse:
+		switch res.Decision {
+		case HookBlock:
+			specific["permissionDecision"] = "deny"
+			specific["permissionDecisionReason"] = res.Reason
+		case HookApprove:
+			specific["permissionDecision"] = "allow"
+			specific["permissionDecisionReason"] = res.Reason
+		}
+	case HookPostToolUse, HookStop, HookUserPromptSubmit:
+		if res.Decision == HookBlock {
+			out["decision"] = "block"
+			out["reason"] = res.Reason
+		}
+	}
+	if res.AdditionalContext != "" && event != HookStop {
+		specific["additionalContext"] = res.AdditionalContext
+	}
+
+	if len(specific) > 0 {
+		specific["hookEventName"] = event
+		out["hookSpecificOutput"] = specific
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,257 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// localRunner is a RunnerFunc that reports running the CLI locally; the
+// tests run the hook commands themselves.
+type localRunner RunnerFunc
+
+func (f localRunner) Run(ctx context.Context, cmd *Command) error {
+	return f(ctx, cmd)
+}
+
+func (localRunner) Local() bool {
+	return true
+}
+
+// hookSettings reads the settings file passed to the CLI in args.
+func hookSettings(t *testing.T, args []string) (path string, settings map[string]any) {
+	t.Helper()
+	i := slices.Index(args, "--settings")
+	if i < 0 {
+		t.Fatalf("no --settings in %q", args)
+	}
+	path = args[i+1]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+	return path, settings
+}
+
+// runHooks runs the hook commands registered in settings for event whose
+// matcher is in matchers, as the CLI would, and returns their outputs and
+// exit codes.
+func runHooks(t *testing.T, settings map[string]any, event HookEvent, matchers []string, payload string) (outputs []string, codes []int) {
+	t.Helper()
+	entries, _ := settings["hooks"].(map[string]any)[string(event)].([]any)
+	for _, e := range entries {
+		entry := e.(map[string]any)
+		if m, _ := entry["matcher"].(string); matchers != nil && !slices.Contains(matchers, m) {
+			continue
+		}
+		for _, h := range entry["hooks"].([]any) {
+			command := h.(map[string]any)["command"].(string)
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Stdin = strings.NewReader(payload)
+			out, err := cmd.Output()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, string(out))
+			codes = append(codes, code)
+		}
+	}
+	return outputs, codes
+}
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var edited []string
+
+	hooks := []Hook{
+		PreToolUseHook("Bash", func(ctx context.Context, in PreToolUseInput) HookResult {
+			var input struct {
+				Command string `json:"command"`
+			}
+			json.Unmarshal(in.ToolInput, &input)
+			if strings.Contains(input.Command, "rm -rf") {
+				return HookResult{Decision: HookBlock, Reason: "rm -rf is not allowed"}
+			}
+			return HookResult{Decision: HookApprove}
+		}),
+		PostToolUseHook("Edit|Write", func(ctx context.Context, in PostToolUseInput) HookResult {
+			var input struct {
+				FilePath string `json:"file_path"`
+			}
+			json.Unmarshal(in.ToolInput, &input)
+			mu.Lock()
+			edited = append(edited, in.ToolName+" "+input.FilePath+" "+in.SessionID)
+			mu.Unlock()
+			return HookResult{}
+		}),
+		UserPromptSubmitHook(func(ctx context.Context, in UserPromptSubmitInput) HookResult {
+			return HookResult{AdditionalContext: "The user's prompt was: " + in.Prompt}
+		}),
+		StopHook(func(ctx context.Context, in StopInput) HookResult {
+			if in.StopHookActive {
+				return HookResult{}
+			}
+			return HookResult{Decision: HookBlock, Reason: "run the tests first"}
+		}),
+	}
+
+	var settingsPath string
+	r := localRunner(func(ctx context.Context, cmd *Command) error {
+		var settings map[string]any
+		settingsPath, settings = hookSettings(t, cmd.Args)
+		if settings["model"] != "opus" {
+			t.Errorf("user settings not merged: %v", settings)
+		}
+		if pre := settings["hooks"].(map[string]any)["PreToolUse"].([]any); len(pre) != 2 {
+			t.Errorf("PreToolUse hooks = %v, want the user's and ours", pre)
+		}
+
+		out, codes := runHooks(t, settings, HookPreToolUse, []string{"Bash"},
+			`{"session_id":"s1","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"rm -rf /"}}`)
+		if codes[0] != 0 || !strings.Contains(out[0], `"permissionDecision":"deny"`) || !strings.Contains(out[0], "rm -rf is not allowed") {
+			t.Errorf("block output = %q (exit %d)", out[0], codes[0])
+		}
+		out, _ = runHooks(t, settings, HookPreToolUse, []string{"Bash"},
+			`{"session_id":"s1","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`)
+		if !strings.Contains(out[0], `"permissionDecision":"allow"`) {
+			t.Errorf("approve output = %q", out[0])
+		}
+
+		out, codes = runHooks(t, settings, HookPostToolUse, []string{"Edit|Write"},
+			`{"session_id":"s1","hook_event_name":"PostToolUse","tool_name":"Write","tool_input":{"file_path":"a.go"},"tool_response":{"success":true}}`)
+		if codes[0] != 0 || out[0] != "" {
+			t.Errorf("empty result output = %q (exit %d)", out[0], codes[0])
+		}
+
+		out, _ = runHooks(t, settings, HookUserPromptSubmit, nil,
+			`{"session_id":"s1","hook_event_name":"UserPromptSubmit","prompt":"fix the bug"}`)
+		var ctxOut struct {
+			HookSpecificOutput struct {
+				HookEventName     string `json:"hookEventName"`
+				AdditionalContext string `json:"additionalContext"`
+			} `json:"hookSpecificOutput"`
+		}
+		if err := json.Unmarshal([]byte(out[0]), &ctxOut); err != nil ||
+			ctxOut.HookSpecificOutput.HookEventName != "UserPromptSubmit" ||
+			ctxOut.HookSpecificOutput.AdditionalContext != "The user's prompt was: fix the bug" {
+			t.Errorf("context output = %q", out[0])
+		}
+
+		out, _ = runHooks(t, settings, HookStop, nil, `{"session_id":"s1","hook_event_name":"Stop","stop_hook_active":false}`)
+		if !strings.Contains(out[0], `"decision":"block"`) || !strings.Contains(out[0], "run the tests first") {
+			t.Errorf("stop output = %q", out[0])
+		}
+		out, _ = runHooks(t, settings, HookStop, nil, `{"session_id":"s1","hook_event_name":"Stop","stop_hook_active":true}`)
+		if out[0] != "" {
+			t.Errorf("active stop output = %q", out[0])
+		}
+
+		io.WriteString(cmd.Stdout, `{"result":"ok","session_id":"s1"}`)
+		return nil
+	})
+
+	userSettings := `{"model":"opus","hooks":{"PreToolUse":[{"matcher":"Read","hooks":[{"type":"command","command":"true"}]}]}}`
+	c := NewClient(WithRunner(r), WithSettings(userSettings), WithHooks(hooks...))
+	if _, err := c.AskJSON(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(edited) != 1 || edited[0] != "Write a.go s1" {
+		t.Errorf("edited = %q", edited)
+	}
+	if _, err := os.Stat(filepath.Dir(settingsPath)); !os.IsNotExist(err) {
+		t.Errorf("hook directory not removed: %v", err)
+	}
+}
+
+func TestHookSettingsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"env":{"A":"1"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := localRunner(func(ctx context.Context, cmd *Command) error {
+		if n := strings.Count(strings.Join(cmd.Args, " "), "--settings"); n != 1 {
+			t.Errorf("--settings passed %d times", n)
+		}
+		_, settings := hookSettings(t, cmd.Args)
+		if settings["env"].(map[string]any)["A"] != "1" || settings["hooks"].(map[string]any)["Stop"] == nil {
+			t.Errorf("settings = %v", settings)
+		}
+		io.WriteString(cmd.Stdout, "ok")
+		return nil
+	})
+	stop := StopHook(func(ctx context.Context, in StopInput) HookResult { return HookResult{} })
+	c := NewClient(WithRunner(r), WithWorkDir(dir), WithSettings("settings.json"), WithHooks(stop))
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreToolUseHookFailsClosed(t *testing.T) {
+	noop := func(ctx context.Context, in PreToolUseInput) HookResult { return HookResult{} }
+	post := func(ctx context.Context, in PostToolUseInput) HookResult { return HookResult{} }
+	r := localRunner(func(ctx context.Context, cmd *Command) error {
+		_, settings := hookSettings(t, cmd.Args)
+		// A payload the handler cannot decode makes the hook server fail.
+		if _, codes := runHooks(t, settings, HookPreToolUse, nil, `{"tool_input":`); codes[0] != 2 {
+			t.Errorf("PreToolUse exit = %d, want 2", codes[0])
+		}
+		if _, codes := runHooks(t, settings, HookPostToolUse, nil, `{"tool_input":`); codes[0] == 0 || codes[0] == 2 {
+			t.Errorf("PostToolUse exit = %d, want a non-blocking error", codes[0])
+		}
+		io.WriteString(cmd.Stdout, "ok")
+		return nil
+	})
+	c := NewClient(WithRunner(r), WithHooks(PreToolUseHook("", noop), PostToolUseHook("", post)))
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHookConfigErrors(t *testing.T) {
+	stop := StopHook(func(ctx context.Context, in StopInput) HookResult { return HookResult{} })
+	stop.Matcher = "Bash"
+	r := localRunner(func(ctx context.Context, cmd *Command) error {
+		t.Error("CLI started despite invalid hooks")
+		return nil
+	})
+	for _, h := range []Hook{stop, {Event: HookStop}} {
+		c := NewClient(WithRunner(r), WithHooks(h))
+		if _, err := c.Ask(context.Background(), "hi"); err == nil {
+			t.Errorf("hook %+v: no error", h)
+		}
+	}
+	c := NewClient(WithRunner(r), WithSettings(`{"hooks":[]}`), WithHooks(StopHook(func(ctx context.Context, in StopInput) HookResult { return HookResult{} })))
+	if _, err := c.Ask(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "hooks is not an object") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestHooksRequireLocalRunner(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		t.Error("CLI started with hooks and a sandboxed Runner")
+		return nil
+	})
+	stop := StopHook(func(ctx context.Context, in StopInput) HookResult { return HookResult{} })
+	for _, runner := range []Runner{r, PrefixRunner(ExecRunner{}, "firejail", "--quiet")} {
+		c := NewClient(WithRunner(runner), WithHooks(stop))
+		if _, err := c.Ask(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "LocalRunner") {
+			t.Errorf("err = %v", err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHookPayloadSize bounds the size of a hook payload.
+const maxHookPayloadSize = 16 << 20
+
+// hookServer dispatches the hooks of a single CLI invocation to Go handlers.
+// It listens on a Unix socket in a temporary directory readable only by the
+// current user; the directory also holds the generated settings file.
+type hookServer struct {
+	hooks []Hook
+	curl  string
+	dir   string
+	sock  string
+	srv   *http.Server
+
+	// ctx carries the values of the call's context to hook handlers and is
+	// cancelled when the server is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startHookServer starts a hook server for hooks.
+func startHookServer(ctx context.Context, hooks []Hook) (*hookServer, error) {
+	for _, h := range hooks {
+		switch {
+		case h.handle == nil:
+			return nil, fmt.Errorf("claude: %s hook has no handler", h.Event)
+		case h.Event != HookPreToolUse && h.Event != HookPostToolUse && h.Event != HookStop && h.Event != HookUserPromptSubmit:
+			return nil, fmt.Errorf("claude: unknown hook event %q", h.Event)
+		case h.Matcher != "" && h.Event != HookPreToolUse && h.Event != HookPostToolUse:
+			return nil, fmt.Errorf("claude: %s hooks do not take a matcher", h.Event)
+		}
+	}
+	curl, err := exec.LookPath("curl")
+	if err != nil {
+		return nil, fmt.Errorf("claude: hooks require curl: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "claude-hooks-")
+	if err != nil {
+		return nil, fmt.Errorf("claude: start hook server: %w", err)
+	}
+	hs := &hookServer{
+		hooks: hooks,
+		curl:  curl,
+		dir:   dir,
+		sock:  filepath.Join(dir, "hooks.sock"),
+	}
+	ln, err := net.Listen("unix", hs.sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("claude: start hook server: %w", err)
+	}
+	hs.ctx, hs.cancel = context.WithCancel(ctx)
+	hs.srv = &http.Server{Handler: hs, ReadHeaderTimeout: 10 * time.Second}
+	go hs.srv.Serve(ln)
+	return hs, nil
+}
+
+// close cancels running handlers, waits for them to return and removes the
+// socket and settings file.
+func (hs *hookServer) close() {
+	hs.cancel()
+	hs.srv.Shutdown(context.Background())
+	os.RemoveAll(hs.dir)
+}
+
+// command returns the shell command the CLI runs for the i-th hook. It
+// forwards the payload on stdin to the server and prints the reply.
+func (hs *hookServer) command(i int) string {
+	cmd := fmt.Sprintf("%s -sS --fail -H 'Content-Type: application/json' --data-binary @- --unix-socket %s http://localhost/hooks/%d",
+		shellQuote(hs.curl), shellQuote(hs.sock), i)
+	if hs.hooks[i].Event == HookPreToolUse {
+		// Exit status 2 blocks the tool call; the CLI shows stderr to the
+		// agent as the reason.
+		cmd += " || { echo 'Blocked: the Go PreToolUse hook handler could not be reached.' >&2; exit 2; }"
+	}
+	return cmd
+}
+
+// writeSettings writes a settings file registering the hooks, merged into
+// the user's settings (a file path relative to dir, or a JSON object), and
+// returns its path.
+func (hs *hookServer) writeSettings(user, dir string) (string, error) {
+	settings := map[string]any{}
+	if user != "" {
+		data := []byte(user)
+		if !strings.HasPrefix(strings.TrimSpace(user), "{") {
+			path := user
+			if !filepath.IsAbs(path) && dir != "" {
+				path = filepath.Join(dir, path)
+			}
+			var err error
+			if data, err = os.ReadFile(path); err != nil {
+				return "", fmt.Errorf("claude: read settings: %w", err)
+			}
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return "", fmt.Errorf("claude: parse settings: %w", err)
+		}
+	}
+
+	hooks, _ := settings["hooks"].(map[string]any)
+	if hooks == nil {
+		if _, ok := settings["hooks"]; ok {
+			return "", fmt.Errorf("claude: parse settings: hooks is not an object")
+		}
+		hooks = map[string]any{}
+	}
+	for i, h := range hs.hooks {
+		command := map[string]any{"type": "command", "command": hs.command(i)}
+		if h.Timeout > 0 {
+			command["timeout"] = int(math.Ceil(h.Timeout.Seconds()))
+		}
+		entry := map[string]any{"hooks": []any{command}}
+		if h.Event == HookPreToolUse || h.Event == HookPostToolUse {
+			entry["matcher"] = h.Matcher
+		}
+		list, _ := hooks[string(h.Event)].([]any)
+		hooks[string(h.Event)] = append(list, entry)
+	}
+	settings["hooks"] = hooks
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("claude: encode settings: %w", err)
+	}
+	path := filepath.Join(hs.dir, "settings.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("claude: write settings: %w", err)
+	}
+	return path, nil
+}
+
+func (hs *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hooks/"))
+	if err != nil || i < 0 || i >= len(hs.hooks) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxHookPayloadSize))
+	if err != nil {
+		http.Error(w, "read payload", http.StatusBadRequest)
+		return
+	}
+
+	// Handlers are cancelled when the hook command exits or the server closes.
+	ctx, cancel := context.WithCancel(hs.ctx)
+	defer cancel()
+	stop := context.AfterFunc(r.Context(), cancel)
+	defer stop()
+
+	h := hs.hooks[i]
+	res, err := h.handle(ctx, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := hookOutput(h.Event, res)
+	if out == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// shellQuote quotes s for use in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -4,9 +4,12 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+
+	claude "github.com/shaul1991/claude-go"
 )
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -40,10 +43,9 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleNonStream(w http.ResponseWriter, r *http.Request, req *MessagesRequest, systemPrompt, prompt string) {
-	client := s.buildClient(req, systemPrompt)
-	resp, err := client.AskJSON(r.Context(), prompt)
+	resp, err := s.client.AskJSON(r.Context(), prompt, callOptions(req.Model, systemPrompt)...)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "api_error", err.Error())
+		respondClaudeError(w, err)
 		return
 	}
 
@@ -73,29 +75,27 @@ func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, req *Messa
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	client := s.buildClient(req, systemPrompt)
-	events, errc := client.AskStream(r.Context(), prompt)
+	events, errc := s.client.AskStream(r.Context(), prompt, callOptions(req.Model, systemPrompt)...)
 
 	for ev := range events {
-		if ev.Type != "stream_event" || ev.Event == nil {
+		if ev.Type != "stream_event" {
 			continue
 		}
 
-		var inner struct {
-			Type string `json:"type"`
-		}
-		if err := json.Unmarshal(ev.Event, &inner); err != nil {
+		typed, err := ev.Decode()
+		if err != nil {
 			continue
 		}
 
-		writeSSE(w, flusher, inner.Type, ev.Event)
+		writeSSE(w, flusher, typed.EventType(), ev.Event)
 	}
 
 	if err := <-errc; err != nil {
+		_, errType := errorStatus(err)
 		errData, _ := json.Marshal(ErrorResponse{
 			Type: "error",
 			Error: ErrorDetail{
-				Type:    "api_error",
+				Type:    errType,
 				Message: err.Error(),
 			},
 		})
@@ -225,18 +225,15 @@ func (s *Server) handleQuiz(w http.ResponseWriter, r *http.Request) {
 
 	systemPrompt := buildQuizSystemPrompt(req.Type)
 	userPrompt := buildQuizUserPrompt(&req)
-	schema := quizResultSchema()
 
-	client := s.buildQuizClient(req.Model, systemPrompt)
-	resp, err := client.AskWithSchema(r.Context(), userPrompt, schema)
+	result, resp, err := claude.AskInto[QuizResult](r.Context(), s.quizClient, userPrompt, callOptions(req.Model, systemPrompt)...)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "api_error", err.Error())
-		return
-	}
-
-	var result QuizResult
-	if err := json.Unmarshal([]byte(resp.Result), &result); err != nil {
-		respondError(w, http.StatusInternalServerError, "api_error", "failed to parse quiz result: "+err.Error())
+		var verr *claude.ValidationError
+		if errors.As(err, &verr) {
+			respondError(w, http.StatusInternalServerError, "api_error", "failed to parse quiz result: "+err.Error())
+			return
+		}
+		respondClaudeError(w, err)
 		return
 	}
 
@@ -328,31 +325,3 @@ func buildQuizUserPrompt(req *QuizRequest) string {
 
 	return b.String()
 }
-
-func quizResultSchema() string {
-	return `{
-  "type": "object",
-  "required": ["correct", "score", "feedback", "model_answer"],
-  "properties": {
-    "correct": {
-      "type": "boolean",
-      "description": "Whether the answer is correct"
-    },
-    "score": {
-      "type": "integer",
-      "description": "Score from 0 to 100",
-      "minimum": 0,
-      "maximum": 100
-    },
-    "feedback": {
-      "type": "string",
-      "description": "Detailed feedback in Korean"
-    },
-    "model_answer": {
-      "type": "string",
-      "description": "Model answer in Korean"
-    }
-  },
-  "additionalProperties": false
-}`
-}
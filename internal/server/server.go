@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	claude "github.com/shaul1991/claude-go"
@@ -11,18 +13,50 @@ import (
 type Server struct {
 	mux    *http.ServeMux
 	config ServerConfig
+
+	// client runs messages requests; quizClient additionally repairs a
+	// result that does not match the quiz schema once.
+	client     *claude.Client
+	quizClient *claude.Client
+	pool       *claude.Pool
 }
 
 // NewServer creates a new Server with the given config and registers routes.
 func NewServer(config ServerConfig) *Server {
+	client := newClient(config)
+	var pool *claude.Pool
+	if config.PoolSize > 0 {
+		pool = claude.NewPool(claude.PoolConfig{
+			Size:    config.PoolSize,
+			MaxIdle: config.PoolMaxIdle,
+			MaxUses: 1,
+		})
+		client = client.With(claude.WithPool(pool))
+		// Only requests with the default model and no system prompt are
+		// warmed up front; the pool keeps processes ready for other
+		// model and system prompt combinations once they have been used.
+		pool.Warm(client, callOptions(config.DefaultModel, "")...)
+	}
 	s := &Server{
-		mux:    http.NewServeMux(),
-		config: config,
+		mux:        http.NewServeMux(),
+		config:     config,
+		client:     client,
+		quizClient: client.With(claude.WithSchemaRepair(1)),
+		pool:       pool,
 	}
 	s.routes()
 	return s
 }
 
+// Close stops the server's idle CLI processes. Call it after the HTTP
+// server has shut down.
+func (s *Server) Close() error {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.Close()
+}
+
 func (s *Server) routes() {
 	s.mux.HandleFunc("GET /health", s.handleHealth)
 	s.mux.HandleFunc("POST /v1/messages", s.handleMessages)
@@ -35,56 +69,45 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.ServeHTTP(w, r)
 }
 
-// buildClient creates a claude.Client from the request and server config.
-func (s *Server) buildClient(req *MessagesRequest, systemPrompt string) *claude.Client {
+// newClient creates the base claude.Client from the server config. It is
+// shared by all requests; request-specific settings are passed per call.
+func newClient(config ServerConfig) *claude.Client {
 	var opts []claude.Option
 
-	if req.Model != "" {
-		opts = append(opts, claude.WithModel(req.Model))
+	if config.CLIPath != "" {
+		opts = append(opts, claude.WithCLIPath(config.CLIPath))
 	}
-	if systemPrompt != "" {
-		opts = append(opts, claude.WithSystemPrompt(systemPrompt))
+	if config.WorkDir != "" {
+		opts = append(opts, claude.WithWorkDir(config.WorkDir))
 	}
-	if s.config.CLIPath != "" {
-		opts = append(opts, claude.WithCLIPath(s.config.CLIPath))
+	if config.MaxBudget > 0 {
+		opts = append(opts, claude.WithMaxBudget(config.MaxBudget))
 	}
-	if s.config.WorkDir != "" {
-		opts = append(opts, claude.WithWorkDir(s.config.WorkDir))
+	if config.MaxTurns > 0 {
+		opts = append(opts, claude.WithMaxTurns(config.MaxTurns))
 	}
-	if s.config.MaxBudget > 0 {
-		opts = append(opts, claude.WithMaxBudget(s.config.MaxBudget))
+	if config.MaxConcurrency > 0 {
+		opts = append(opts, claude.WithMaxConcurrency(config.MaxConcurrency), claude.WithMaxQueue(config.MaxQueue))
 	}
-	if s.config.MaxTurns > 0 {
-		opts = append(opts, claude.WithMaxTurns(s.config.MaxTurns))
+	if config.GracePeriod != 0 {
+		opts = append(opts, claude.WithRunner(claude.ExecRunner{GracePeriod: config.GracePeriod}))
 	}
 
 	return claude.NewClient(opts...)
 }
 
-// buildQuizClient creates a claude.Client configured for quiz grading.
-func (s *Server) buildQuizClient(model, systemPrompt string) *claude.Client {
-	var opts []claude.Option
+// callOptions returns the per-call options for a request's model and system prompt.
+func callOptions(model, systemPrompt string) []claude.CallOption {
+	var opts []claude.CallOption
 
 	if model != "" {
-		opts = append(opts, claude.WithModel(model))
+		opts = append(opts, claude.CallModel(model))
 	}
 	if systemPrompt != "" {
-		opts = append(opts, claude.WithSystemPrompt(systemPrompt))
-	}
-	if s.config.CLIPath != "" {
-		opts = append(opts, claude.WithCLIPath(s.config.CLIPath))
-	}
-	if s.config.WorkDir != "" {
-		opts = append(opts, claude.WithWorkDir(s.config.WorkDir))
-	}
-	if s.config.MaxBudget > 0 {
-		opts = append(opts, claude.WithMaxBudget(s.config.MaxBudget))
-	}
-	if s.config.MaxTurns > 0 {
-		opts = append(opts, claude.WithMaxTurns(s.config.MaxTurns))
+		opts = append(opts, claude.CallSystemPrompt(systemPrompt))
 	}
 
-	return claude.NewClient(opts...)
+	return opts
 }
 
 // respondError writes an Anthropic-format error response.
@@ -100,6 +123,62 @@ func respondError(w http.ResponseWriter, status int, errType string, message str
 	})
 }
 
+// statusClientClosedRequest is the non-standard status used when the client
+// went away before the CLI finished.
+const statusClientClosedRequest = 499
+
+// errorStatus maps an error returned by claude.Client to an HTTP status and
+// Anthropic error type.
+func errorStatus(err error) (int, string) {
+	if errors.Is(err, claude.ErrQueueFull) {
+		return http.StatusServiceUnavailable, "overloaded_error"
+	}
+	var berr *claude.BudgetExceededError
+	if errors.As(err, &berr) {
+		return http.StatusPaymentRequired, "billing_error"
+	}
+
+	var cerr *claude.Error
+	if !errors.As(err, &cerr) {
+		return http.StatusInternalServerError, "api_error"
+	}
+
+	switch cerr.Kind {
+	case claude.KindAuth:
+		return http.StatusUnauthorized, "authentication_error"
+	case claude.KindRateLimit:
+		return http.StatusTooManyRequests, "rate_limit_error"
+	case claude.KindOverloaded:
+		return 529, "overloaded_error"
+	case claude.KindBudget:
+		return http.StatusPaymentRequired, "billing_error"
+	case claude.KindMaxTurns:
+		return http.StatusBadRequest, "invalid_request_error"
+	case claude.KindNetwork:
+		return http.StatusBadGateway, "api_error"
+	case claude.KindResourceLimit:
+		var lerr *claude.LimitError
+		if errors.As(err, &lerr) && lerr.Limit == claude.LimitWallClock {
+			return http.StatusGatewayTimeout, "timeout_error"
+		}
+		return http.StatusInternalServerError, "api_error"
+	case claude.KindCanceled:
+		if errors.Is(err, context.DeadlineExceeded) {
+			return http.StatusGatewayTimeout, "timeout_error"
+		}
+		return statusClientClosedRequest, "api_error"
+	default:
+		return http.StatusInternalServerError, "api_error"
+	}
+}
+
+// respondClaudeError writes an Anthropic-format error response for an error
+// returned by claude.Client.
+func respondClaudeError(w http.ResponseWriter, err error) {
+	status, errType := errorStatus(err)
+	respondError(w, status, errType, err.Error())
+}
+
 // respondJSON writes a JSON response with the given status code.
 func respondJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
@@ -1,6 +1,9 @@
 package server
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ServerConfig holds server-level configuration.
 type ServerConfig struct {
@@ -10,6 +13,24 @@ type ServerConfig struct {
 	DefaultModel string
 	MaxBudget    float64
 	MaxTurns     int
+
+	// MaxConcurrency limits the CLI calls running at once; 0 means no
+	// limit. MaxQueue limits the requests waiting for a slot; a negative
+	// value leaves the queue unbounded. Requests arriving at a full queue
+	// get 503 overloaded_error.
+	MaxConcurrency int
+	MaxQueue       int
+
+	// PoolSize enables a warm pool of up to PoolSize CLI processes; 0
+	// disables it. PoolMaxIdle uses the library default when zero. Each
+	// pooled process serves a single request, so that requests from
+	// different callers never share a conversation.
+	PoolSize    int
+	PoolMaxIdle time.Duration
+
+	// GracePeriod is how long a cancelled CLI process group may take to exit
+	// after SIGTERM before it is killed; 0 uses the library default.
+	GracePeriod time.Duration
 }
 
 // --- Anthropic Messages API Request Types ---
@@ -133,10 +154,10 @@ type QuizRequest struct {
 
 // QuizResult holds the grading result from Claude.
 type QuizResult struct {
-	Correct     bool   `json:"correct"`
-	Score       int    `json:"score"`
-	Feedback    string `json:"feedback"`
-	ModelAnswer string `json:"model_answer"`
+	Correct     bool   `json:"correct" jsonschema:"required,description=Whether the answer is correct"`
+	Score       int    `json:"score" jsonschema:"required,min=0,max=100,description=Score from 0 to 100"`
+	Feedback    string `json:"feedback" jsonschema:"required,description=Detailed feedback in Korean"`
+	ModelAnswer string `json:"model_answer" jsonschema:"required,description=Model answer in Korean"`
 }
 
 // QuizResponse is the response body for POST /v1/quiz.
@@ -0,0 +1,175 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is matched by errors.Is against a *QueueFullError.
+var ErrQueueFull = errors.New("claude: call queue full")
+
+// QueueFullError is returned when a call cannot start because the client's
+// concurrency limit is reached and its queue is full. Treat it as
+// backpressure: retry later or reject the work upstream.
+type QueueFullError struct {
+	MaxConcurrency int
+	MaxQueue       int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("claude: call queue full (%d running, %d waiting)", e.MaxConcurrency, e.MaxQueue)
+}
+
+// Is reports whether target is ErrQueueFull.
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// QueueStats is a snapshot of a client's concurrency limit.
+type QueueStats struct {
+	MaxConcurrency int
+	// Running and Queued are the calls currently running and waiting.
+	Running int
+	Queued  int
+	// Admitted counts calls that started, Waited those of them that had to
+	// queue first. Rejected counts QueueFullErrors, Canceled calls whose
+	// context ended while they were queued.
+	Admitted int64
+	Waited   int64
+	Rejected int64
+	Canceled int64
+	// TotalWait and MaxWait are the total and longest time admitted calls
+	// spent in the queue.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// WithMaxConcurrency limits the number of calls the client, and clients
+// derived from it with With, run at once to n. Further calls wait in a FIFO
+// queue until a running call ends or their context is done. A call holds its
+// slot for all of its attempts, and a Session for as long as its process
+// runs. The idle processes of a Pool do not take slots; PoolConfig.Size
+// bounds them, and a pooled call holds a slot while its turn runs.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		c.limiter = nil
+		if n > 0 {
+			c.limiter = &limiter{max: n}
+		}
+	}
+}
+
+// WithMaxQueue limits the number of calls waiting for a slot when
+// WithMaxConcurrency is used. A call arriving at a full queue fails at once
+// with a *QueueFullError; with n = 0 calls never wait. A negative n, the
+// default, leaves the queue unbounded.
+func WithMaxQueue(n int) Option {
+	return func(c *Client) {
+		c.maxQueue = n
+	}
+}
+
+// QueueStats returns a snapshot of the client's concurrency limit. It is
+// zero if WithMaxConcurrency is not used.
+func (c *Client) QueueStats() QueueStats {
+	if c.limiter == nil {
+		return QueueStats{}
+	}
+	return c.limiter.snapshot()
+}
+
+// limiter is a counting semaphore that admits waiting calls in arrival order.
+type limiter struct {
+	max int
+
+	mu      sync.Mutex
+	running int
+	queue   []chan struct{}
+	stats   QueueStats
+}
+
+// acquire waits for a slot and returns how long the call was queued. Calls
+// are rejected when maxQueue (if non-negative) calls are already waiting.
+func (l *limiter) acquire(ctx context.Context, maxQueue int) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, newError(ctx, err, "", "")
+	}
+
+	l.mu.Lock()
+	if l.running < l.max && len(l.queue) == 0 {
+		l.running++
+		l.stats.Admitted++
+		l.mu.Unlock()
+		return 0, nil
+	}
+	if maxQueue >= 0 && len(l.queue) >= maxQueue {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return 0, &QueueFullError{MaxConcurrency: l.max, MaxQueue: maxQueue}
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ready:
+		wait := time.Since(start)
+		l.mu.Lock()
+		l.stats.Admitted++
+		l.stats.Waited++
+		l.stats.TotalWait += wait
+		l.stats.MaxWait = max(l.stats.MaxWait, wait)
+		l.mu.Unlock()
+		return wait, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, q := range l.queue {
+			if q == ready {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				l.stats.Canceled++
+				l.mu.Unlock()
+				return 0, newError(ctx, ctx.Err(), "", "")
+			}
+		}
+		l.mu.Unlock()
+		// The slot was handed over while the context ended; pass it on.
+		l.release()
+		l.mu.Lock()
+		l.stats.Canceled++
+		l.mu.Unlock()
+		return 0, newError(ctx, ctx.Err(), "", "")
+	}
+}
+
+// release frees a slot, handing it to the longest waiting call if any.
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) > 0 {
+		next := l.queue[0]
+		l.queue = l.queue[1:]
+		close(next)
+		return
+	}
+	l.running--
+}
+
+func (l *limiter) snapshot() QueueStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.stats
+	st.MaxConcurrency = l.max
+	st.Running = l.running
+	st.Queued = len(l.queue)
+	return st
+}
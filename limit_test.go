@@ -0,0 +1,148 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedRunner blocks every call until release is closed and records the
+// prompts in the order the calls started.
+type gatedRunner struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	started []string
+}
+
+func (g *gatedRunner) Run(ctx context.Context, cmd *Command) error {
+	g.mu.Lock()
+	g.started = append(g.started, cmd.Args[1])
+	g.mu.Unlock()
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	io.WriteString(cmd.Stdout, `{"result":"ok","session_id":"s1"}`)
+	return nil
+}
+
+func TestMaxConcurrencyFIFO(t *testing.T) {
+	g := &gatedRunner{release: make(chan struct{})}
+	c := NewClient(WithRunner(g), WithMaxConcurrency(1))
+
+	var wg sync.WaitGroup
+	resps := make([]*Response, 4)
+	for i, prompt := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.AskJSON(context.Background(), prompt)
+			if err != nil {
+				t.Error(err)
+			}
+			resps[i] = resp
+		}()
+		// Start the calls one after another so that the queue order is known.
+		waitFor(t, "call "+prompt, func() bool {
+			st := c.QueueStats()
+			return st.Running+st.Queued == i+1
+		})
+	}
+	if st := c.QueueStats(); st.Running != 1 || st.Queued != 3 || st.MaxConcurrency != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(g.release)
+	wg.Wait()
+
+	if got := g.started; len(got) != 4 || got[0] != "a" || got[1] != "b" || got[2] != "c" || got[3] != "d" {
+		t.Errorf("start order = %q", got)
+	}
+	if resps[0].QueueWait != 0 || resps[3].QueueWait < 10*time.Millisecond {
+		t.Errorf("queue waits = %v, %v", resps[0].QueueWait, resps[3].QueueWait)
+	}
+	st := c.QueueStats()
+	if st.Running != 0 || st.Queued != 0 || st.Admitted != 4 || st.Waited != 3 || st.MaxWait < 10*time.Millisecond || st.TotalWait < st.MaxWait {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestMaxQueueFull(t *testing.T) {
+	g := &gatedRunner{release: make(chan struct{})}
+	c := NewClient(WithRunner(g), WithMaxConcurrency(1), WithMaxQueue(1))
+
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Ask(context.Background(), "hi"); err != nil {
+				t.Error(err)
+			}
+		}()
+		waitFor(t, "call", func() bool {
+			st := c.QueueStats()
+			return st.Running+st.Queued == i+1
+		})
+	}
+
+	_, err := c.Ask(context.Background(), "hi")
+	var qerr *QueueFullError
+	if !errors.Is(err, ErrQueueFull) || !errors.As(err, &qerr) || qerr.MaxConcurrency != 1 || qerr.MaxQueue != 1 {
+		t.Errorf("err = %v", err)
+	}
+	close(g.release)
+	wg.Wait()
+	if st := c.QueueStats(); st.Rejected != 1 || st.Admitted != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestMaxConcurrencyContextWhileQueued(t *testing.T) {
+	g := &gatedRunner{release: make(chan struct{})}
+	c := NewClient(WithRunner(g), WithMaxConcurrency(1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Ask(context.Background(), "first")
+	}()
+	waitFor(t, "first call", func() bool { return c.QueueStats().Running == 1 })
+
+	// Clients derived with With share the limit.
+	derived := c.With(WithModel("haiku"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := derived.AskJSON(ctx, "second")
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v", err)
+	}
+	if st := c.QueueStats(); st.Queued != 0 || st.Canceled != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	close(g.release)
+	<-done
+	if st := c.QueueStats(); st.Running != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestMaxQueueZeroNeverWaits(t *testing.T) {
+	g := &gatedRunner{release: make(chan struct{})}
+	c := NewClient(WithRunner(g), WithMaxConcurrency(1), WithMaxQueue(0))
+
+	s := c.Stream(context.Background(), "first")
+	waitFor(t, "first call", func() bool { return c.QueueStats().Running == 1 })
+	if _, err := c.Stream(context.Background(), "second").Result(); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("err = %v", err)
+	}
+	close(g.release)
+	s.Result()
+}
@@ -0,0 +1,121 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// MCPTransport is the transport used to reach an MCP server.
+type MCPTransport string
+
+const (
+	MCPStdio MCPTransport = "stdio"
+	MCPSSE   MCPTransport = "sse"
+	MCPHTTP  MCPTransport = "http"
+)
+
+// MCPServer configures an MCP server made available to the CLI. Stdio
+// servers are started by the CLI from Command; SSE and HTTP servers are
+// reached at URL.
+type MCPServer struct {
+	// Type is the transport. It defaults to MCPStdio.
+	Type MCPTransport `json:"type"`
+
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// StdioMCPServer returns an MCPServer the CLI starts as a subprocess.
+func StdioMCPServer(command string, args ...string) MCPServer {
+	return MCPServer{Type: MCPStdio, Command: command, Args: args}
+}
+
+// SSEMCPServer returns an MCPServer reached over server-sent events.
+func SSEMCPServer(url string) MCPServer {
+	return MCPServer{Type: MCPSSE, URL: url}
+}
+
+// HTTPMCPServer returns an MCPServer reached over streamable HTTP.
+func HTTPMCPServer(url string) MCPServer {
+	return MCPServer{Type: MCPHTTP, URL: url}
+}
+
+// MCPServerStatus is the connection status of an MCP server, as reported in
+// the system init event of a stream.
+type MCPServerStatus struct {
+	Name string `json:"name"`
+	// Status is reported by the CLI, e.g. "connected", "failed" or "pending".
+	Status string `json:"status"`
+}
+
+// WithMCPServer adds an MCP server under name. The servers are written to a
+// private temporary file passed with --mcp-config, which is removed when the
+// process exits.
+func WithMCPServer(name string, server MCPServer) Option {
+	return func(c *Client) {
+		// Copy so that clients derived with With do not share the map.
+		servers := maps.Clone(c.mcpServers)
+		if servers == nil {
+			servers = map[string]MCPServer{}
+		}
+		servers[name] = server
+		c.mcpServers = servers
+	}
+}
+
+// validate reports a configuration error in s.
+func (s MCPServer) validate() error {
+	switch s.Type {
+	case "", MCPStdio:
+		if s.Command == "" {
+			return fmt.Errorf("stdio server requires a command")
+		}
+	case MCPSSE, MCPHTTP:
+		if s.URL == "" {
+			return fmt.Errorf("%s server requires a URL", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", s.Type)
+	}
+	return nil
+}
+
+// writeMCPConfig writes servers in the CLI's --mcp-config format to a new
+// temporary file readable only by the current user and returns its path.
+func writeMCPConfig(servers map[string]MCPServer) (string, error) {
+	config := map[string]map[string]MCPServer{"mcpServers": {}}
+	for name, s := range servers {
+		if err := s.validate(); err != nil {
+			return "", fmt.Errorf("claude: MCP server %q: %w", name, err)
+		}
+		if s.Type == "" {
+			s.Type = MCPStdio
+		}
+		config["mcpServers"][name] = s
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("claude: encode MCP config: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "claude-mcp-*.json")
+	if err != nil {
+		return "", fmt.Errorf("claude: write MCP config: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("claude: write MCP config: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("claude: write MCP config: %w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,152 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// mcpConfigPath returns the value of --mcp-config in args.
+func mcpConfigPath(t *testing.T, args []string) string {
+	t.Helper()
+	for i, a := range args {
+		if a == "--mcp-config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	t.Fatalf("no --mcp-config in %q", args)
+	return ""
+}
+
+func TestMCPConfigFile(t *testing.T) {
+	var path string
+	var config map[string]map[string]map[string]any
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		path = mcpConfigPath(t, cmd.Args)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Errorf("config file mode = %v, want 0600", perm)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return err
+		}
+		io.WriteString(cmd.Stdout, "ok")
+		return nil
+	})
+
+	fs := StdioMCPServer("npx", "-y", "@modelcontextprotocol/server-filesystem", "/data")
+	fs.Env = map[string]string{"DEBUG": "1"}
+	api := HTTPMCPServer("https://mcp.example.com/mcp")
+	api.Headers = map[string]string{"Authorization": "Bearer token"}
+	c := NewClient(WithRunner(r), WithMCPServer("fs", fs), WithMCPServer("api", api))
+
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := config["mcpServers"]
+	if servers["fs"]["type"] != "stdio" || servers["fs"]["command"] != "npx" || servers["fs"]["env"].(map[string]any)["DEBUG"] != "1" {
+		t.Errorf("fs = %v", servers["fs"])
+	}
+	if servers["api"]["type"] != "http" || servers["api"]["url"] != "https://mcp.example.com/mcp" {
+		t.Errorf("api = %v", servers["api"])
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("config file not removed: %v", err)
+	}
+}
+
+func TestMCPConfigRemovedOnCancelAndPanic(t *testing.T) {
+	var path string
+	ctx, cancel := context.WithCancel(context.Background())
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		path = mcpConfigPath(t, cmd.Args)
+		if strings.Contains(cmd.Args[1], "panic") {
+			panic("runner failed")
+		}
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c := NewClient(WithRunner(r), WithMCPServer("fs", StdioMCPServer("mcp-fs")))
+
+	if _, err := c.Stream(ctx, "hi").Result(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("config file not removed after cancel: %v", err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		c.Ask(context.Background(), "panic")
+	}()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("config file not removed after panic: %v", err)
+	}
+}
+
+func TestMCPServerValidation(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		t.Error("runner called with invalid MCP config")
+		return nil
+	})
+	c := NewClient(WithRunner(r), WithMCPServer("remote", MCPServer{Type: MCPSSE}))
+
+	_, err := c.Ask(context.Background(), "hi")
+	if err == nil || !strings.Contains(err.Error(), `MCP server "remote"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestWithMCPServerDoesNotShareMap(t *testing.T) {
+	base := NewClient(WithMCPServer("a", StdioMCPServer("a")))
+	derived := base.With(WithMCPServer("b", StdioMCPServer("b")))
+
+	if len(base.mcpServers) != 1 || len(derived.mcpServers) != 2 {
+		t.Errorf("base = %v, derived = %v", base.mcpServers, derived.mcpServers)
+	}
+}
+
+func TestStreamMCPServerStatus(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"system","subtype":"init","session_id":"s1","mcp_servers":[{"name":"fs","status":"connected"},{"name":"api","status":"failed"}]}`+"\n")
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"ok","session_id":"s1"}`+"\n")
+		return nil
+	})
+	s := NewClient(WithRunner(r)).Stream(context.Background(), "hi")
+
+	var initEv *SystemInitEvent
+	for ev := range s.Events() {
+		typed, err := ev.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := typed.(*SystemInitEvent); ok {
+			initEv = e
+		}
+	}
+	resp, err := s.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []MCPServerStatus{{Name: "fs", Status: "connected"}, {Name: "api", Status: "failed"}}
+	if initEv == nil || len(initEv.MCPServers) != 2 || initEv.MCPServers[1] != want[1] {
+		t.Errorf("init MCP servers = %+v", initEv)
+	}
+	if len(resp.MCPServers) != 2 || resp.MCPServers[0] != want[0] {
+		t.Errorf("resp.MCPServers = %+v", resp.MCPServers)
+	}
+}
@@ -52,9 +52,170 @@ func WithWorkDir(dir string) Option {
 	}
 }
 
+// WithDisallowedTools sets the --disallowedTools flag.
+func WithDisallowedTools(tools ...string) Option {
+	return func(c *Client) {
+		c.disallowedTools = tools
+	}
+}
+
+// WithPermissionMode sets the --permission-mode flag.
+func WithPermissionMode(mode PermissionMode) Option {
+	return func(c *Client) {
+		c.permissionMode = mode
+	}
+}
+
+// WithAddDirs sets the --add-dir flag: additional directories tools may access.
+func WithAddDirs(dirs ...string) Option {
+	return func(c *Client) {
+		c.addDirs = dirs
+	}
+}
+
+// WithSettings sets the --settings flag: a settings file path or JSON string.
+func WithSettings(settings string) Option {
+	return func(c *Client) {
+		c.settings = settings
+	}
+}
+
+// WithFallbackModel sets the --fallback-model flag, used when the main model
+// is overloaded.
+func WithFallbackModel(model string) Option {
+	return func(c *Client) {
+		c.fallbackModel = model
+	}
+}
+
+// WithSessionID sets the --session-id flag: the UUID of the session to create.
+func WithSessionID(id string) Option {
+	return func(c *Client) {
+		c.sessionID = id
+	}
+}
+
+// WithForkSession sets the --fork-session flag: resumed sessions continue
+// under a new session ID.
+func WithForkSession() Option {
+	return func(c *Client) {
+		c.forkSession = true
+	}
+}
+
+// WithStrictMCPConfig sets the --strict-mcp-config flag: only MCP servers
+// given to this client are used.
+func WithStrictMCPConfig() Option {
+	return func(c *Client) {
+		c.strictMCPConfig = true
+	}
+}
+
+// WithAgents sets the --agents flag, defining custom subagents by name.
+func WithAgents(agents map[string]Agent) Option {
+	return func(c *Client) {
+		c.agents = agents
+	}
+}
+
+// WithVerbose sets the --verbose flag. Stream-json calls always pass it.
+func WithVerbose() Option {
+	return func(c *Client) {
+		c.verbose = true
+	}
+}
+
+// WithExtraArgs appends raw arguments to every invocation, for CLI flags
+// without a typed option. Flags managed by the library (see the other
+// options) are rejected when a call is made.
+func WithExtraArgs(args ...string) Option {
+	return func(c *Client) {
+		c.extraArgs = args
+	}
+}
+
 // WithCLIPath overrides the default "claude" binary path.
 func WithCLIPath(path string) Option {
 	return func(c *Client) {
 		c.cliPath = path
 	}
 }
+
+// WithRetryPolicy enables automatic retries of transient CLI failures
+// (rate limiting, overload, network errors) with exponential backoff.
+// Streaming calls are only retried while no event has been emitted.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = &p
+	}
+}
+
+// WithSchemaRepair makes AskWithSchema and AskInto resume the session up to n
+// times when the result does not match the schema, asking for a corrected answer.
+func WithSchemaRepair(n int) Option {
+	return func(c *Client) {
+		c.schemaRepairs = n
+	}
+}
+
+// WithRunner replaces the Runner used to start CLI processes (default ExecRunner).
+func WithRunner(r Runner) Option {
+	id := runnerIdentity(r)
+	return func(c *Client) {
+		c.runner = r
+		c.runnerID = id
+	}
+}
+
+// CallOption overrides a client setting for a single call, for example
+// client.Ask(ctx, prompt, CallModel("haiku"), CallMaxTurns(1)).
+//
+// The Call helpers cover the settings most often changed per call. Any
+// Option converts to a CallOption, so other settings can be overridden the
+// same way:
+//
+//	client.Ask(ctx, prompt, CallOption(WithPermissionMode(PermissionPlan)))
+//
+// Options that change how the client runs processes, such as WithRunner,
+// WithPool or WithMaxConcurrency, should not be used per call.
+type CallOption func(*Client)
+
+// CallModel overrides the --model flag for one call.
+func CallModel(model string) CallOption {
+	return CallOption(WithModel(model))
+}
+
+// CallSystemPrompt overrides the --system-prompt flag for one call.
+func CallSystemPrompt(prompt string) CallOption {
+	return CallOption(WithSystemPrompt(prompt))
+}
+
+// CallAppendSystemPrompt overrides the --append-system-prompt flag for one call.
+func CallAppendSystemPrompt(prompt string) CallOption {
+	return CallOption(WithAppendSystemPrompt(prompt))
+}
+
+// CallAllowedTools overrides the --allowedTools flag for one call.
+func CallAllowedTools(tools ...string) CallOption {
+	return CallOption(WithAllowedTools(tools...))
+}
+
+// CallMaxTurns overrides the --max-turns flag for one call.
+func CallMaxTurns(n int) CallOption {
+	return CallOption(WithMaxTurns(n))
+}
+
+// CallMaxBudget overrides the --max-budget-usd flag for one call.
+func CallMaxBudget(usd float64) CallOption {
+	return CallOption(WithMaxBudget(usd))
+}
+
+// CallWorkDir overrides the working directory for one call.
+func CallWorkDir(dir string) CallOption {
+	return CallOption(WithWorkDir(dir))
+}
+
+// CallSchemaRepair overrides the number of schema repair attempts for one call.
+func CallSchemaRepair(n int) CallOption {
+	return CallOption(WithSchemaRepair(n))
+}
@@ -0,0 +1,94 @@
+package claude
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+)
+
+// recordArgs returns a Runner that answers every call with a JSON result and
+// records the arguments and directory of each command.
+func recordArgs(mu *sync.Mutex, got *[]*Command) Runner {
+	return RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		mu.Lock()
+		*got = append(*got, cmd)
+		mu.Unlock()
+		io.WriteString(cmd.Stdout, `{"result":"ok","session_id":"s1"}`)
+		return nil
+	})
+}
+
+func TestCallOptionsOverrideForOneCall(t *testing.T) {
+	var mu sync.Mutex
+	var got []*Command
+	c := NewClient(WithRunner(recordArgs(&mu, &got)), WithModel("opus"), WithMaxTurns(5), WithWorkDir("/base"))
+
+	if _, err := c.AskJSON(context.Background(), "hi", CallModel("haiku"), CallMaxTurns(1), CallWorkDir("/other")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AskJSON(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertArgs(t, []string{"-p", "hi", "--output-format", "json", "--model", "haiku", "--max-turns", "1"}, got[0].Args)
+	if got[0].Dir != "/other" {
+		t.Errorf("dir = %q, want /other", got[0].Dir)
+	}
+	assertArgs(t, []string{"-p", "hi", "--output-format", "json", "--model", "opus", "--max-turns", "5"}, got[1].Args)
+	if got[1].Dir != "/base" {
+		t.Errorf("dir = %q, want /base", got[1].Dir)
+	}
+}
+
+func TestCallOptionsOnStreamsAndConversations(t *testing.T) {
+	var mu sync.Mutex
+	var got []*Command
+	c := NewClient(WithRunner(recordArgs(&mu, &got)))
+
+	c.Stream(context.Background(), "hi", CallSystemPrompt("terse")).Result()
+	cv := c.NewConversation()
+	if _, err := cv.Send(context.Background(), "hi", CallAllowedTools("Read")); err != nil {
+		t.Fatal(err)
+	}
+
+	assertArgs(t, []string{"-p", "hi", "--output-format", "stream-json", "--verbose", "--include-partial-messages", "--system-prompt", "terse"}, got[0].Args)
+	assertArgs(t, []string{"-p", "hi", "--output-format", "json", "--allowedTools", "Read"}, got[1].Args)
+}
+
+func TestWithDerivesClient(t *testing.T) {
+	base := NewClient(WithModel("opus"), WithMaxTurns(3))
+	derived := base.With(WithModel("haiku"), WithSchemaRepair(2))
+
+	if base.model != "opus" || base.schemaRepairs != 0 {
+		t.Errorf("base modified: model=%q repairs=%d", base.model, base.schemaRepairs)
+	}
+	if derived.model != "haiku" || derived.maxTurns != 3 || derived.schemaRepairs != 2 {
+		t.Errorf("derived = model %q, maxTurns %d, repairs %d", derived.model, derived.maxTurns, derived.schemaRepairs)
+	}
+}
+
+func TestCallOptionsConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	var got []*Command
+	c := NewClient(WithRunner(recordArgs(&mu, &got)))
+
+	var wg sync.WaitGroup
+	for _, model := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.AskJSON(context.Background(), model, CallModel(model))
+		}()
+	}
+	wg.Wait()
+
+	for _, cmd := range got {
+		if cmd.Args[1] != cmd.Args[len(cmd.Args)-1] {
+			t.Errorf("prompt %q ran with model %q", cmd.Args[1], cmd.Args[len(cmd.Args)-1])
+		}
+	}
+	if c.model != "" {
+		t.Errorf("client model changed to %q", c.model)
+	}
+}
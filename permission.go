@@ -0,0 +1,182 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// PermissionBehavior is the outcome of a permission decision.
+type PermissionBehavior string
+
+const (
+	PermissionAllow PermissionBehavior = "allow"
+	PermissionDeny  PermissionBehavior = "deny"
+)
+
+// ToolRequest is a tool use the agent asks permission for.
+type ToolRequest struct {
+	ToolName  string          `json:"tool_name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+}
+
+// Decision is the answer of a PermissionHandler. The zero Decision denies
+// the request.
+type Decision struct {
+	Behavior PermissionBehavior
+	// Message tells the agent why the request was denied.
+	Message string
+	// UpdatedInput replaces the tool input when the request is allowed. It
+	// is encoded as JSON; nil keeps the original input.
+	UpdatedInput any
+}
+
+// Allow returns a Decision allowing the request unchanged.
+func Allow() Decision {
+	return Decision{Behavior: PermissionAllow}
+}
+
+// AllowWithInput returns a Decision allowing the request with input in place
+// of the input the agent asked for.
+func AllowWithInput(input any) Decision {
+	return Decision{Behavior: PermissionAllow, UpdatedInput: input}
+}
+
+// Deny returns a Decision denying the request with a message for the agent.
+func Deny(message string) Decision {
+	return Decision{Behavior: PermissionDeny, Message: message}
+}
+
+// PermissionHandler decides whether the agent may use a tool. It is called
+// from the in-process tool server while the CLI waits for the answer.
+type PermissionHandler func(ctx context.Context, req ToolRequest) Decision
+
+// PermissionDecision records a permission request and the decision taken,
+// for auditing.
+type PermissionDecision struct {
+	ToolName  string             `json:"tool_name"`
+	ToolUseID string             `json:"tool_use_id,omitempty"`
+	Input     json.RawMessage    `json:"input"`
+	Behavior  PermissionBehavior `json:"behavior"`
+	Message   string             `json:"message,omitempty"`
+	// UpdatedInput is the input the tool ran with, if the handler changed it.
+	UpdatedInput json.RawMessage `json:"updated_input,omitempty"`
+	Time         time.Time       `json:"time"`
+}
+
+// WithPermissionHandler answers the CLI's permission prompts with h. The
+// handler is exposed as a tool of the in-process MCP server and passed with
+// --permission-prompt-tool. It is consulted for tool uses that are neither
+// allowed nor denied by the permission mode and tool lists. Every decision
+// is recorded in Response.PermissionDecisions.
+func WithPermissionHandler(h PermissionHandler) Option {
+	return func(c *Client) {
+		c.permissionHandler = h
+	}
+}
+
+// permissionToolName is the name of the tool answering permission prompts.
+const permissionToolName = "permission_prompt"
+
+// permissionTool returns the tool that answers permission prompts with h and
+// records each decision in log.
+func permissionTool(h PermissionHandler, log *callLog) ToolDef {
+	t := Tool(permissionToolName, func(ctx context.Context, req ToolRequest) (string, error) {
+		d := h(ctx, req)
+		rec := PermissionDecision{
+			ToolName:  req.ToolName,
+			ToolUseID: req.ToolUseID,
+			Input:     req.Input,
+			Behavior:  d.Behavior,
+			Message:   d.Message,
+			Time:      time.Now(),
+		}
+
+		reply := map[string]any{}
+		if d.Behavior == PermissionAllow {
+			input := req.Input
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			if d.UpdatedInput != nil {
+				data, err := json.Marshal(d.UpdatedInput)
+				if err != nil {
+					rec.Behavior = PermissionDeny
+					rec.Message = "claude: encode updated input: " + err.Error()
+				} else {
+					input = data
+					rec.UpdatedInput = data
+				}
+			}
+			reply["updatedInput"] = input
+		}
+		if rec.Behavior != PermissionAllow {
+			rec.Behavior = PermissionDeny
+			if rec.Message == "" {
+				rec.Message = "Permission denied"
+			}
+			reply = map[string]any{"message": rec.Message}
+		}
+		reply["behavior"] = rec.Behavior
+		log.addDecision(rec)
+
+		data, err := json.Marshal(reply)
+		return string(data), err
+	})
+	t.Description = "Answers permission prompts for tool use. Called by the CLI; not for direct use."
+	t.internal = true
+
+	// Accept fields the CLI may add to the request in the future.
+	t.parsed.AdditionalProperties = nil
+	schema, _ := json.Marshal(t.parsed)
+	t.schema = string(schema)
+	return t
+}
+
+// callLog collects what happens during a single call, to be reported on its
+// Response. A nil *callLog discards everything.
+type callLog struct {
+	mu        sync.Mutex
+	decisions []PermissionDecision
+	queueWait time.Duration
+}
+
+func (l *callLog) addDecision(d PermissionDecision) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decisions = append(l.decisions, d)
+}
+
+func (l *callLog) setQueueWait(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queueWait = d
+}
+
+// apply copies the collected records to resp.
+func (l *callLog) apply(resp *Response) {
+	if l == nil || resp == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resp.PermissionDecisions = append([]PermissionDecision(nil), l.decisions...)
+	resp.QueueWait = l.queueWait
+}
+
+// take moves the collected records to resp, so that the next call of a
+// long-running session starts with an empty log.
+func (l *callLog) take(resp *Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resp.PermissionDecisions = l.decisions
+	l.decisions = nil
+}
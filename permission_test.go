@@ -0,0 +1,114 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPermissionHandler(t *testing.T) {
+	handler := func(ctx context.Context, req ToolRequest) Decision {
+		var in struct {
+			Command  string `json:"command"`
+			FilePath string `json:"file_path"`
+		}
+		json.Unmarshal(req.Input, &in)
+		switch {
+		case strings.Contains(in.Command, "rm -rf"):
+			return Deny("destructive commands are not allowed")
+		case in.FilePath != "":
+			return AllowWithInput(map[string]string{"file_path": "/sandbox/" + in.FilePath})
+		case req.ToolName == "Read":
+			return Allow()
+		}
+		return Decision{}
+	}
+
+	var replies []map[string]any
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		if i := slices.Index(cmd.Args, "--permission-prompt-tool"); i < 0 || cmd.Args[i+1] != "mcp__go__permission_prompt" {
+			t.Errorf("args = %q", cmd.Args)
+		}
+		m := newMCPClient(t, cmd.Args)
+		for _, req := range []map[string]any{
+			{"tool_name": "Bash", "input": map[string]any{"command": "rm -rf /"}, "tool_use_id": "t1"},
+			{"tool_name": "Write", "input": map[string]any{"file_path": "notes.txt"}, "tool_use_id": "t2"},
+			{"tool_name": "Read", "input": map[string]any{"path": "go.mod"}, "tool_use_id": "t3"},
+			{"tool_name": "WebFetch", "input": map[string]any{"url": "https://example.com"}},
+		} {
+			res := m.callTool(permissionToolName, req)
+			if res.IsError {
+				t.Fatalf("permission tool failed: %+v", res)
+			}
+			var reply map[string]any
+			if err := json.Unmarshal([]byte(res.Content[0].Text), &reply); err != nil {
+				t.Fatal(err)
+			}
+			replies = append(replies, reply)
+		}
+		io.WriteString(cmd.Stdout, `{"result":"ok","session_id":"s1"}`)
+		return nil
+	})
+
+	c := NewClient(WithRunner(r), WithPermissionMode(PermissionDefault), WithPermissionHandler(handler))
+	resp, err := c.AskJSON(context.Background(), "clean up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replies[0]["behavior"] != "deny" || replies[0]["message"] != "destructive commands are not allowed" {
+		t.Errorf("deny reply = %v", replies[0])
+	}
+	if replies[1]["behavior"] != "allow" || replies[1]["updatedInput"].(map[string]any)["file_path"] != "/sandbox/notes.txt" {
+		t.Errorf("modified input reply = %v", replies[1])
+	}
+	if replies[2]["behavior"] != "allow" || replies[2]["updatedInput"].(map[string]any)["path"] != "go.mod" {
+		t.Errorf("allow reply = %v", replies[2])
+	}
+	if replies[3]["behavior"] != "deny" {
+		t.Errorf("zero decision reply = %v", replies[3])
+	}
+
+	got := resp.PermissionDecisions
+	if len(got) != 4 {
+		t.Fatalf("decisions = %+v", got)
+	}
+	if got[0].ToolName != "Bash" || got[0].ToolUseID != "t1" || got[0].Behavior != PermissionDeny {
+		t.Errorf("decision 0 = %+v", got[0])
+	}
+	if got[1].Behavior != PermissionAllow || string(got[1].UpdatedInput) != `{"file_path":"/sandbox/notes.txt"}` {
+		t.Errorf("decision 1 = %+v", got[1])
+	}
+	if got[3].Behavior != PermissionDeny || got[3].Message == "" || got[3].Time.IsZero() {
+		t.Errorf("decision 3 = %+v", got[3])
+	}
+}
+
+func TestPermissionDecisionsOnStream(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"system","subtype":"init","session_id":"s1"}`+"\n")
+		newMCPClient(t, cmd.Args).callTool(permissionToolName, map[string]any{"tool_name": "Bash", "input": map[string]any{"command": "ls"}})
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"ok","session_id":"s1"}`+"\n")
+		return nil
+	})
+	c := NewClient(WithRunner(r), WithPermissionHandler(func(ctx context.Context, req ToolRequest) Decision {
+		return Allow()
+	}))
+
+	s := c.Stream(context.Background(), "list files")
+	for ev := range s.Events() {
+		if strings.HasPrefix(ev.Type, "tool_call") {
+			t.Errorf("permission prompt reported as %s event", ev.Type)
+		}
+	}
+	resp, err := s.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.PermissionDecisions) != 1 || resp.PermissionDecisions[0].Behavior != PermissionAllow {
+		t.Errorf("decisions = %+v", resp.PermissionDecisions)
+	}
+}
@@ -0,0 +1,473 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PoolConfig configures a Pool. Zero fields take the values of
+// DefaultPoolConfig.
+type PoolConfig struct {
+	// Size is the maximum number of processes held by the pool, idle and
+	// busy. When it is reached and no idle process can be evicted, calls run
+	// on a fresh process outside the pool.
+	Size int
+	// MinIdle is the number of idle processes kept ready per configuration
+	// once it has been used.
+	MinIdle int
+	// MaxIdle is how long a process may stay idle before it is stopped.
+	MaxIdle time.Duration
+	// MaxUses is the number of turns a process runs before it is stopped. With
+	// more than one, later calls continue the conversation of earlier ones, so
+	// only raise it when that is acceptable.
+	MaxUses int
+	// HealthCheckInterval is how often idle processes are checked and
+	// expired ones stopped.
+	HealthCheckInterval time.Duration
+}
+
+// DefaultPoolConfig returns the configuration used for zero PoolConfig
+// fields: 4 processes, 1 idle per configuration, 5 minutes idle time, 1 use
+// per process and a health check every 30 seconds.
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		Size:                4,
+		MinIdle:             1,
+		MaxIdle:             5 * time.Minute,
+		MaxUses:             1,
+		HealthCheckInterval: 30 * time.Second,
+	}
+}
+
+// PoolStats is a snapshot of a Pool's state and counters.
+type PoolStats struct {
+	// Idle and Busy count the processes in the pool; Starting counts the
+	// processes being started to refill it.
+	Idle     int
+	Busy     int
+	Starting int
+	// Hits counts calls served by an idle process, Misses calls that had to
+	// start one or ran outside the pool.
+	Hits   int64
+	Misses int64
+	// Started and Stopped count processes over the pool's lifetime.
+	Started int64
+	Stopped int64
+}
+
+// Pool keeps CLI processes running in stream-json input mode (see
+// OpenSession) so that calls do not wait for the CLI to start. Processes are
+// keyed by the configuration they were started with: the CLI path, working
+// directory, arguments and MCP servers, including per-call options. A call
+// checks out an idle process with its configuration, runs one turn and
+// returns it, and the pool starts replacements in the background.
+//
+// A Pool is attached to clients with WithPool and may be shared by several
+// clients. Processes are also keyed by the Runner that started them, so a
+// call never runs on a process started by another Runner: Runners that can
+// be compared, such as ExecRunner values, are the same if they are equal;
+// others, such as RunnerFuncs, only if set by the same WithRunner option.
+type Pool struct {
+	config PoolConfig
+	done   chan struct{}
+	// wg tracks the health check and the processes being started.
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	closed   bool
+	idle     map[string][]*pooledSession
+	starting map[string]int
+	clients  map[string]*Client
+	// runners holds the identities of the Runners seen, which keys refer to
+	// by index.
+	runners []any
+	total   int
+	stats   PoolStats
+}
+
+// pooledSession is a process owned by a Pool.
+type pooledSession struct {
+	key       string
+	session   *Session
+	uses      int
+	idleSince time.Time
+}
+
+// NewPool creates a Pool and starts its health checks. Close it to stop its
+// processes.
+func NewPool(config PoolConfig) *Pool {
+	def := DefaultPoolConfig()
+	if config.Size <= 0 {
+		config.Size = def.Size
+	}
+	if config.MinIdle <= 0 {
+		config.MinIdle = def.MinIdle
+	}
+	if config.MaxIdle <= 0 {
+		config.MaxIdle = def.MaxIdle
+	}
+	if config.MaxUses <= 0 {
+		config.MaxUses = def.MaxUses
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = def.HealthCheckInterval
+	}
+
+	p := &Pool{
+		config:   config,
+		idle:     map[string][]*pooledSession{},
+		starting: map[string]int{},
+		clients:  map[string]*Client{},
+		done:     make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.healthCheck()
+	return p
+}
+
+// WithPool runs Ask, AskJSON, Stream and AskStream calls on processes from p.
+// Calls that need a fresh process (Resume, Continue, Pipe, schemas) and
+// clients with Go tools, hooks, a permission handler, a stream budget, a
+// wall-clock timeout or a budget tracker with a cost limit do not use the
+// pool. Pooled calls are admitted and charged by the calling client's budget
+// trackers, whichever client started the process.
+// Retries are not performed for pooled calls.
+func WithPool(p *Pool) Option {
+	return func(c *Client) {
+		c.pool = p
+	}
+}
+
+// Warm starts processes for c's configuration until MinIdle are idle, so
+// that the first calls do not wait either. It returns without waiting for
+// them to be ready.
+func (p *Pool) Warm(c *Client, opts ...CallOption) {
+	c = c.forCall(opts)
+	key := p.key(c)
+	if key == "" {
+		return
+	}
+	p.mu.Lock()
+	if _, ok := p.clients[key]; !ok {
+		p.clients[key] = c.poolClient()
+	}
+	p.mu.Unlock()
+	p.refill(key)
+}
+
+// Stats returns a snapshot of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.stats
+	for _, list := range p.idle {
+		st.Idle += len(list)
+	}
+	for _, n := range p.starting {
+		st.Starting += n
+	}
+	st.Busy = p.total - st.Idle - st.Starting
+	return st
+}
+
+// Close stops the idle processes and waits for them to exit. Busy processes
+// are stopped when their call ends. Later calls run outside the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	var idle []*pooledSession
+	for key, list := range p.idle {
+		idle = append(idle, list...)
+		delete(p.idle, key)
+	}
+	p.total -= len(idle)
+	p.stats.Stopped += int64(len(idle))
+	p.mu.Unlock()
+
+	close(p.done)
+	var wg sync.WaitGroup
+	for _, ps := range idle {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps.session.Close()
+		}()
+	}
+	wg.Wait()
+	p.wg.Wait()
+	return nil
+}
+
+// key returns the key of the configuration of c's pooled processes, or ""
+// if c cannot use a pool.
+func (p *Pool) key(c *Client) string {
+	if len(c.tools) > 0 || len(c.hooks) > 0 || c.permissionHandler != nil || c.hasCostLimit() || c.streamBudget.enabled() || c.wallClock > 0 {
+		return ""
+	}
+	key, _ := json.Marshal(struct {
+		Runner int
+		Path   string
+		Dir    string
+		Args   []string
+		MCP    map[string]MCPServer
+		Limits ResourceLimits
+	}{p.runnerIndex(c), c.cliPath, c.workDir, c.sessionArgs(), c.mcpServers, c.limits})
+	return string(key)
+}
+
+// runnerIndex returns the index of c's Runner in p.runners, adding it if it
+// is new.
+func (p *Pool) runnerIndex(c *Client) int {
+	id := c.runnerID
+	if id == nil {
+		id = c.runner
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if i := slices.Index(p.runners, id); i >= 0 {
+		return i
+	}
+	p.runners = append(p.runners, id)
+	return len(p.runners) - 1
+}
+
+// runnerIdentity returns what identifies r to a Pool: r itself if it can be
+// compared, or else a new pointer, unique to the WithRunner option.
+func runnerIdentity(r Runner) (id any) {
+	defer func() {
+		if recover() != nil {
+			id = new(byte)
+		}
+	}()
+	// Comparing panics for Runners holding funcs, maps or slices.
+	_ = any(r) == any(r)
+	return r
+}
+
+// poolClient returns the client that opens c's pooled processes. They are
+// shared by all clients with the same configuration, so they do not carry
+// c's budget trackers; pooledStream admits and charges the caller's instead.
+func (c *Client) poolClient() *Client {
+	if len(c.budgets) == 0 {
+		return c
+	}
+	shared := *c
+	shared.budgets = nil
+	return &shared
+}
+
+// pooledStream runs prompt as one turn on a pooled process, or on a fresh
+// process when the pool has no room. It returns nil if c cannot use the pool.
+func (c *Client) pooledStream(ctx context.Context, prompt string) *Stream {
+	if c.pool == nil {
+		return nil
+	}
+	key := c.pool.key(c)
+	if key == "" {
+		return nil
+	}
+
+	s := &Stream{
+		events: make(chan StreamEvent),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		defer close(s.events)
+
+		wait, err := c.limiter.acquire(ctx, c.maxQueue)
+		if err != nil {
+			s.err = err
+			return
+		}
+		defer c.limiter.release()
+
+		for _, b := range c.budgets {
+			if _, err := b.admit(); err != nil {
+				s.err = err
+				return
+			}
+		}
+		ps, err := c.pool.checkout(c, key)
+		if err != nil {
+			s.err = err
+			return
+		}
+		if ps == nil {
+			s.resp, s.err = c.runStreamAcquired(ctx, c.buildArgs(prompt, FormatStreamJSON), nil, s.events, wait)
+			return
+		}
+		ps.session.turnMu.Lock()
+		s.resp, s.err = ps.session.turn(ctx, prompt, s.events)
+		ps.session.turnMu.Unlock()
+		if s.resp != nil {
+			c.chargeBudget(s.resp)
+		}
+		// A turn that ended with a result left the process ready for the next.
+		c.pool.checkin(ps, s.resp != nil)
+		if s.resp != nil {
+			s.resp.QueueWait = wait
+		}
+	}()
+	return s
+}
+
+// checkout takes an idle process for key, or starts one if the pool has
+// room. It returns nil if the call should run outside the pool.
+func (p *Pool) checkout(c *Client, key string) (*pooledSession, error) {
+	c = c.poolClient()
+	p.mu.Lock()
+	if p.closed {
+		p.stats.Misses++
+		p.mu.Unlock()
+		return nil, nil
+	}
+	if _, ok := p.clients[key]; !ok {
+		p.clients[key] = c
+	}
+
+	for list := p.idle[key]; len(list) > 0; list = p.idle[key] {
+		// Use the most recently returned process, so that surplus ones expire.
+		ps := list[len(list)-1]
+		p.idle[key] = list[:len(list)-1]
+		if !ps.session.alive() {
+			p.stop(ps)
+			continue
+		}
+		p.stats.Hits++
+		p.mu.Unlock()
+		p.refill(key)
+		return ps, nil
+	}
+
+	p.stats.Misses++
+	if p.total >= p.config.Size && !p.evictIdle() {
+		p.mu.Unlock()
+		return nil, nil
+	}
+	p.total++
+	p.stats.Started++
+	p.mu.Unlock()
+
+	s, err := c.openSession(context.Background(), nil)
+	if err != nil {
+		p.mu.Lock()
+		p.total--
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.refill(key)
+	return &pooledSession{key: key, session: s}, nil
+}
+
+// checkin returns ps to the pool after a turn, or stops it if it failed,
+// has been used up or the pool is closed.
+func (p *Pool) checkin(ps *pooledSession, ok bool) {
+	p.mu.Lock()
+	ps.uses++
+	if !ok || ps.uses >= p.config.MaxUses || p.closed || !ps.session.alive() {
+		p.stop(ps)
+	} else {
+		ps.idleSince = time.Now()
+		p.idle[ps.key] = append(p.idle[ps.key], ps)
+	}
+	p.mu.Unlock()
+	p.refill(ps.key)
+}
+
+// refill starts processes for key in the background until MinIdle are idle
+// or starting, as far as the size limit allows.
+func (p *Pool) refill(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := p.clients[key]
+	for !p.closed && c != nil && len(p.idle[key])+p.starting[key] < p.config.MinIdle && p.total < p.config.Size {
+		p.total++
+		p.starting[key]++
+		p.stats.Started++
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			s, err := c.openSession(context.Background(), nil)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.starting[key]--
+			switch {
+			case err != nil:
+				p.total--
+			case p.closed:
+				p.stop(&pooledSession{key: key, session: s})
+			default:
+				p.idle[key] = append(p.idle[key], &pooledSession{key: key, session: s, idleSince: time.Now()})
+			}
+		}()
+	}
+}
+
+// evictIdle stops the process that has been idle the longest, to make room
+// for another configuration. It reports whether there was one. p.mu must be
+// held.
+func (p *Pool) evictIdle() bool {
+	var oldest *pooledSession
+	for _, list := range p.idle {
+		if len(list) > 0 && (oldest == nil || list[0].idleSince.Before(oldest.idleSince)) {
+			oldest = list[0]
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	p.idle[oldest.key] = p.idle[oldest.key][1:]
+	p.stop(oldest)
+	return true
+}
+
+// stop removes ps from the pool's count and closes it in the background.
+// p.mu must be held.
+func (p *Pool) stop(ps *pooledSession) {
+	p.total--
+	p.stats.Stopped++
+	go ps.session.Close()
+}
+
+// healthCheck periodically stops idle processes that have exited or have
+// been idle for longer than MaxIdle.
+func (p *Pool) healthCheck() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			for key, list := range p.idle {
+				list = slices.DeleteFunc(list, func(ps *pooledSession) bool {
+					if ps.session.alive() && now.Sub(ps.idleSince) < p.config.MaxIdle {
+						return false
+					}
+					p.stop(ps)
+					return true
+				})
+				p.idle[key] = list
+				if len(list) == 0 && p.starting[key] == 0 {
+					// Forget configurations that are no longer used; the next
+					// call with one starts over.
+					delete(p.idle, key)
+					delete(p.starting, key)
+					delete(p.clients, key)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
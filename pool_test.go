@@ -0,0 +1,231 @@
+package claude
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// poolCLI is a fake CLI that runs sessionCLI when started in stream-json
+// input mode and answers a single prompt otherwise. It records the arguments
+// of every start.
+type poolCLI struct {
+	t        *testing.T
+	sessions atomic.Int32
+	single   atomic.Int32
+
+	mu   sync.Mutex
+	args [][]string
+}
+
+func (p *poolCLI) Run(ctx context.Context, cmd *Command) error {
+	p.mu.Lock()
+	p.args = append(p.args, cmd.Args)
+	p.mu.Unlock()
+	if slices.Contains(cmd.Args, "--input-format") {
+		return sessionCLI(p.t, &p.sessions).Run(ctx, cmd)
+	}
+	p.single.Add(1)
+	io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"single","session_id":"s2"}`+"\n")
+	return nil
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolUsesWarmProcesses(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{})
+	defer pool.Close()
+	c := NewClient(WithRunner(cli), WithPool(pool))
+
+	pool.Warm(c)
+	waitFor(t, "warm process", func() bool { return pool.Stats().Idle == 1 })
+
+	ctx := context.Background()
+	for _, prompt := range []string{"one", "two", "three"} {
+		resp, err := c.AskJSON(ctx, prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Result != "echo: "+prompt {
+			t.Errorf("Result = %q", resp.Result)
+		}
+		waitFor(t, "refill", func() bool { return pool.Stats().Idle == 1 })
+	}
+	if text, err := c.Ask(ctx, "four"); err != nil || text != "echo: four" {
+		t.Errorf("Ask = %q, %v", text, err)
+	}
+	s := c.Stream(ctx, "five")
+	n := 0
+	for range s.Events() {
+		n++
+	}
+	if resp, err := s.Result(); err != nil || resp.Result != "echo: five" || n == 0 {
+		t.Errorf("Stream: %d events, resp = %+v, err = %v", n, resp, err)
+	}
+	waitFor(t, "refill", func() bool { return pool.Stats().Idle == 1 })
+
+	st := pool.Stats()
+	if st.Hits != 5 || st.Misses != 0 || st.Started != 6 || st.Stopped != 5 || st.Busy != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+	if cli.single.Load() != 0 {
+		t.Errorf("%d calls ran outside the pool", cli.single.Load())
+	}
+
+	// A different per-call model is a different configuration.
+	if _, err := c.AskJSON(ctx, "six", CallModel("haiku")); err != nil {
+		t.Fatal(err)
+	}
+	if st := pool.Stats(); st.Misses != 1 {
+		t.Errorf("stats after model change = %+v", st)
+	}
+	cli.mu.Lock()
+	last := cli.args[len(cli.args)-1]
+	cli.mu.Unlock()
+	if i := slices.Index(last, "--model"); i < 0 || last[i+1] != "haiku" {
+		t.Errorf("args = %q", last)
+	}
+
+	pool.Close()
+	if st := pool.Stats(); st.Idle != 0 || st.Busy != 0 {
+		t.Errorf("stats after Close = %+v", st)
+	}
+	if _, err := c.AskJSON(ctx, "after"); err != nil || cli.single.Load() != 1 {
+		t.Errorf("call after Close: err = %v, single = %d", err, cli.single.Load())
+	}
+}
+
+func TestPoolKeepsRunnersApart(t *testing.T) {
+	sandbox, local := &poolCLI{t: t}, &poolCLI{t: t}
+	pool := NewPool(PoolConfig{})
+	defer pool.Close()
+	a := NewClient(WithRunner(sandbox), WithPool(pool))
+	b := NewClient(WithRunner(local), WithPool(pool))
+
+	pool.Warm(a)
+	waitFor(t, "warm process", func() bool { return pool.Stats().Idle == 1 })
+	if _, err := b.AskJSON(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	// b's call and the refill after it start processes with b's runner.
+	if n, m := sandbox.sessions.Load(), local.sessions.Load(); n != 1 || m == 0 {
+		t.Errorf("processes started by a's runner = %d, by b's = %d", n, m)
+	}
+	if st := pool.Stats(); st.Hits != 0 || st.Misses != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	// Runners that cannot be compared are told apart by their option.
+	fn := RunnerFunc(sandbox.Run)
+	c := NewClient(WithRunner(fn), WithPool(pool))
+	d := NewClient(WithRunner(fn), WithPool(pool))
+	if pool.key(c) == pool.key(d) {
+		t.Error("clients with separate RunnerFunc options share a key")
+	}
+	if pool.key(c) != pool.key(c.With(WithModel(""))) {
+		t.Error("a derived client has a different key")
+	}
+}
+
+func TestPoolMaxUses(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{Size: 1, MaxUses: 3})
+	defer pool.Close()
+	c := NewClient(WithRunner(cli), WithPool(pool))
+
+	for range 3 {
+		if _, err := c.AskJSON(context.Background(), "hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first process served all three calls and was replaced.
+	waitFor(t, "replacement", func() bool { return pool.Stats().Idle == 1 && cli.sessions.Load() == 2 })
+	if st := pool.Stats(); st.Hits != 2 || st.Misses != 1 || st.Stopped != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestPoolFullRunsOutsidePool(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{Size: 1})
+	defer pool.Close()
+	c := NewClient(WithRunner(cli), WithPool(pool))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := c.Stream(ctx, "slow")
+	<-slow.Events()
+
+	resp, err := c.AskJSON(context.Background(), "hi")
+	if err != nil || resp.Result != "single" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	cancel()
+	slow.Result()
+	if st := pool.Stats(); st.Misses != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{MaxIdle: 50 * time.Millisecond, HealthCheckInterval: 10 * time.Millisecond})
+	defer pool.Close()
+	c := NewClient(WithRunner(cli), WithPool(pool))
+
+	pool.Warm(c)
+	waitFor(t, "warm process", func() bool { return pool.Stats().Started == 1 })
+	waitFor(t, "idle expiry", func() bool { st := pool.Stats(); return st.Stopped == 1 && st.Idle == 0 })
+}
+
+func TestPoolReplacesExitedProcess(t *testing.T) {
+	cli := &poolCLI{t: t}
+	var crashed atomic.Bool
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		if crashed.CompareAndSwap(false, true) {
+			return &ExitError{Code: 1}
+		}
+		return cli.Run(ctx, cmd)
+	})
+	pool := NewPool(PoolConfig{})
+	defer pool.Close()
+	c := NewClient(WithRunner(r), WithPool(pool))
+
+	pool.Warm(c)
+	waitFor(t, "warm process", func() bool { return pool.Stats().Idle == 1 })
+	resp, err := c.AskJSON(context.Background(), "hi")
+	if err != nil || resp.Result != "echo: hi" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if st := pool.Stats(); st.Hits != 0 || st.Misses != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestPoolBypassedForGoTools(t *testing.T) {
+	cli := &poolCLI{t: t}
+	pool := NewPool(PoolConfig{})
+	defer pool.Close()
+	c := NewClient(WithRunner(cli), WithPool(pool), WithTools(Tool("lookup_order", lookupOrder)))
+
+	if _, err := c.AskJSON(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if cli.sessions.Load() != 0 || cli.single.Load() != 1 {
+		t.Errorf("sessions = %d, single = %d", cli.sessions.Load(), cli.single.Load())
+	}
+}
@@ -0,0 +1,59 @@
+package claude
+
+import "strings"
+
+// ModelPrice is the API price of a model in USD per million tokens.
+type ModelPrice struct {
+	InputPerMTok      float64
+	OutputPerMTok     float64
+	CacheWritePerMTok float64
+	CacheReadPerMTok  float64
+}
+
+// Pricing maps model name prefixes to prices. A model is priced by the
+// longest prefix that matches its name, so the "" entry, if any, prices
+// models without a more specific entry.
+type Pricing map[string]ModelPrice
+
+// DefaultPricing returns the list prices of current Claude models. Unknown
+// models are priced like Opus 4, the most expensive entry, so that limits are
+// never enforced too late. Copy and adjust the table for negotiated prices or
+// new models.
+func DefaultPricing() Pricing {
+	opus := ModelPrice{InputPerMTok: 15, OutputPerMTok: 75, CacheWritePerMTok: 18.75, CacheReadPerMTok: 1.5}
+	sonnet := ModelPrice{InputPerMTok: 3, OutputPerMTok: 15, CacheWritePerMTok: 3.75, CacheReadPerMTok: 0.3}
+	return Pricing{
+		"":                  opus,
+		"claude-opus-4":     opus,
+		"claude-opus-4-5":   {InputPerMTok: 5, OutputPerMTok: 25, CacheWritePerMTok: 6.25, CacheReadPerMTok: 0.5},
+		"claude-sonnet-4":   sonnet,
+		"claude-3-7-sonnet": sonnet,
+		"claude-haiku-4-5":  {InputPerMTok: 1, OutputPerMTok: 5, CacheWritePerMTok: 1.25, CacheReadPerMTok: 0.1},
+		"claude-3-5-haiku":  {InputPerMTok: 0.8, OutputPerMTok: 4, CacheWritePerMTok: 1, CacheReadPerMTok: 0.08},
+	}
+}
+
+// Price returns the price of model and whether the table has an entry for it.
+func (p Pricing) Price(model string) (ModelPrice, bool) {
+	var (
+		best  ModelPrice
+		found bool
+		n     = -1
+	)
+	for prefix, price := range p {
+		if len(prefix) > n && strings.HasPrefix(model, prefix) {
+			best, found, n = price, true, len(prefix)
+		}
+	}
+	return best, found
+}
+
+// Cost returns the cost in USD of usage by model, or 0 if the table has no
+// entry for it.
+func (p Pricing) Cost(model string, usage Usage) float64 {
+	price, _ := p.Price(model)
+	return (float64(usage.InputTokens)*price.InputPerMTok +
+		float64(usage.OutputTokens)*price.OutputPerMTok +
+		float64(usage.CacheCreationInputTokens)*price.CacheWritePerMTok +
+		float64(usage.CacheReadInputTokens)*price.CacheReadPerMTok) / 1e6
+}
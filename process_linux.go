@@ -0,0 +1,33 @@
+//go:build linux
+
+package claude
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// setDeathSignal has the kernel kill the CLI when the thread that started it
+// exits, which is when the Go program dies without cancelling its calls.
+func setDeathSignal(a *syscall.SysProcAttr) {
+	a.Pdeathsig = syscall.SIGKILL
+}
+
+// waitExit blocks until p has exited, without reaping it, and reports
+// whether that could be waited for.
+func waitExit(p *os.Process) bool {
+	const (
+		pPID    = 1
+		wNOWAIT = 0x1000000
+	)
+	var info [128]byte // siginfo_t
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(p.Pid),
+			uintptr(unsafe.Pointer(&info)), syscall.WEXITED|wNOWAIT, 0, 0)
+		// ECHILD means Wait has already reaped the process.
+		if errno != syscall.EINTR {
+			return errno == 0 || errno == syscall.ECHILD
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package claude
+
+import (
+	"os"
+	"syscall"
+)
+
+// setDeathSignal does nothing: only Linux kills children with their parent.
+func setDeathSignal(a *syscall.SysProcAttr) {}
+
+// waitExit reports false: waiting for an exit without reaping the process is
+// only supported on Linux.
+func waitExit(p *os.Process) bool {
+	return false
+}
@@ -0,0 +1,119 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls automatic retries of transient CLI failures.
+// Zero MaxAttempts, backoff and Multiplier fields take the values of
+// DefaultRetryPolicy; a zero Jitter disables jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Set it to 1 to disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each attempt.
+	Multiplier float64
+	// Jitter is the fraction (0-1) of each delay that is randomized.
+	Jitter float64
+	// Retryable decides whether an error should be retried. Defaults to IsRetryable.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns the policy used for zero RetryPolicy fields:
+// 3 attempts with exponential backoff from 1s to 30s and 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      IsRetryable,
+	}
+}
+
+// IsRetryable reports whether err is a transient CLI failure: rate limiting,
+// API overload or a network error.
+func IsRetryable(err error) bool {
+	var cerr *Error
+	if !errors.As(err, &cerr) {
+		return false
+	}
+	switch cerr.Kind {
+	case KindRateLimit, KindOverloaded, KindNetwork:
+		return true
+	}
+	return false
+}
+
+// attempts returns the effective number of attempts; a nil policy means one.
+func (p *RetryPolicy) attempts() int {
+	if p == nil {
+		return 1
+	}
+	if p.MaxAttempts < 1 {
+		return DefaultRetryPolicy().MaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the retry following the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	def := DefaultRetryPolicy()
+	initial, maxDelay, mult, jitter := p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter
+	if initial <= 0 {
+		initial = def.InitialBackoff
+	}
+	if maxDelay <= 0 {
+		maxDelay = def.MaxBackoff
+	}
+	if mult < 1 {
+		mult = def.Multiplier
+	}
+	jitter = min(max(jitter, 0), 1)
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(maxDelay); i++ {
+		d *= mult
+	}
+	d = min(d, float64(maxDelay))
+	d -= d * jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// retry reports whether the failed attempt should be retried, sleeping for
+// the backoff delay first. It gives up without sleeping when attempts are
+// exhausted, err is not retryable, or the delay would outlast ctx's deadline.
+func (p *RetryPolicy) retry(ctx context.Context, attempt int, err error) bool {
+	if attempt >= p.attempts() || ctx.Err() != nil {
+		return false
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	if !retryable(err) {
+		return false
+	}
+
+	delay := p.backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,106 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyCLI returns a fake CLI that fails with stderr on its first `failures`
+// invocations and then runs script.
+func flakyCLI(t *testing.T, failures int, stderr, script string) string {
+	t.Helper()
+	counter := filepath.Join(t.TempDir(), "count")
+	return writeFakeCLI(t, `n=$(cat `+counter+` 2>/dev/null || echo 0)
+echo $((n+1)) > `+counter+`
+if [ "$n" -lt `+strconv.Itoa(failures)+` ]; then echo "`+stderr+`" >&2; exit 1; fi
+`+script)
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	cli := flakyCLI(t, 2, "API Error: 529 overloaded", `echo ok`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	out, err := c.Ask(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "ok" {
+		t.Errorf("out = %q", out)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	cli := flakyCLI(t, 5, "API Error: 429 rate limited", `echo ok`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+	if _, err := c.Ask(context.Background(), "hi"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	cli := flakyCLI(t, 1, "Invalid API key", `echo ok`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	if _, err := c.Ask(context.Background(), "hi"); !errors.Is(err, ErrAuth) {
+		t.Errorf("err = %v, want ErrAuth", err)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	cli := flakyCLI(t, 1, "API Error: 529 overloaded", `echo ok`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.Ask(ctx, "hi"); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("err = %v, want ErrOverloaded", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("retry slept past the context deadline")
+	}
+}
+
+func TestRetryPipeReplaysInput(t *testing.T) {
+	cli := flakyCLI(t, 1, "ECONNRESET", `cat`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+	out, err := c.Pipe(context.Background(), strings.NewReader("log line"), "summarize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "log line" {
+		t.Errorf("out = %q", out)
+	}
+}
+
+func TestRetryStreamBeforeFirstEvent(t *testing.T) {
+	cli := flakyCLI(t, 1, "API Error: 529 overloaded",
+		`echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1"}'`)
+	c := NewClient(WithCLIPath(cli), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+	resp, err := c.Stream(context.Background(), "hi").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "ok" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestRetryBackoffGrowth(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
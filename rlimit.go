@@ -0,0 +1,159 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResourceLimits limits each CLI process. ExecRunner applies them on Linux
+// before the CLI runs: the process starts as a /bin/sh shim that waits until
+// its limits are set and then execs the CLI. Elsewhere they are ignored. Zero
+// fields are unlimited.
+type ResourceLimits struct {
+	// CPUTime limits the CPU time of the process (RLIMIT_CPU), rounded up to
+	// whole seconds.
+	CPUTime time.Duration
+	// AddressSpace limits the virtual memory of the process in bytes
+	// (RLIMIT_AS). Node.js reserves a lot of address space, so leave room.
+	AddressSpace uint64
+	// OpenFiles limits the number of open file descriptors (RLIMIT_NOFILE).
+	OpenFiles uint64
+	// Processes limits the number of processes (RLIMIT_NPROC). The kernel
+	// counts all processes of the user, not only those of the run; use
+	// Cgroup for a limit per run.
+	Processes uint64
+
+	// Cgroup is a cgroup v2 directory delegated to the caller. When set, each
+	// process is started in a new child cgroup of it (moved there before
+	// the CLI runs on kernels older than 5.7), whose pids.max is set to
+	// Processes and memory.max to MemoryMax. This is best effort: if the
+	// cgroup cannot be created or joined, the process runs without it.
+	Cgroup    string
+	MemoryMax uint64
+}
+
+// isZero reports whether l limits nothing.
+func (l ResourceLimits) isZero() bool {
+	return l == ResourceLimits{}
+}
+
+// Limit names a resource limit in a *LimitError.
+type Limit string
+
+const (
+	LimitCPUTime      Limit = "cpu time"
+	LimitAddressSpace Limit = "address space"
+	LimitOpenFiles    Limit = "open files"
+	LimitProcesses    Limit = "processes"
+	LimitMemory       Limit = "cgroup memory"
+	LimitWallClock    Limit = "wall-clock time"
+)
+
+// LimitError reports that a run failed because it reached a resource limit.
+// It is wrapped in an *Error of kind KindResourceLimit.
+type LimitError struct {
+	Limit Limit
+	// Err is the error the process failed with.
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit reached: %v", e.Limit, e.Err)
+}
+
+// Unwrap returns the error the process failed with.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrResourceLimit.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrResourceLimit
+}
+
+// WithResourceLimits sets the resource limits of every CLI process started
+// by the client, including sessions and pooled processes.
+func WithResourceLimits(l ResourceLimits) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+// WithWallClockTimeout stops a call's CLI process when it has run for d,
+// independently of the call's context; the call then fails with a
+// *LimitError for LimitWallClock. Each attempt of a retried call gets the
+// full time. Sessions are not limited, and calls do not use a Pool while a
+// timeout is set.
+func WithWallClockTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.wallClock = d
+	}
+}
+
+// errWallClock is the cause of the context of a process that ran out of
+// wall-clock time.
+var errWallClock = errors.New("wall-clock timeout")
+
+// execute runs cmd with the client's Runner and wall-clock timeout.
+func (c *Client) execute(ctx context.Context, cmd *Command) error {
+	if c.wallClock <= 0 {
+		return c.runner.Run(ctx, cmd)
+	}
+	runCtx, cancel := context.WithTimeoutCause(ctx, c.wallClock, errWallClock)
+	defer cancel()
+	err := c.runner.Run(runCtx, cmd)
+	if err != nil && ctx.Err() == nil && context.Cause(runCtx) == errWallClock {
+		return &LimitError{Limit: LimitWallClock, Err: err}
+	}
+	return err
+}
+
+// runError is newError for a failed process of c. Failures caused by a
+// resource limit that the process only reports in its output are recognized
+// as well.
+func (c *Client) runError(ctx context.Context, err error, stderr, stdout string) *Error {
+	e := newError(ctx, err, stderr, stdout)
+	if e.Kind == KindCanceled || e.Kind == KindResourceLimit {
+		return e
+	}
+	if limit := c.limits.fromOutput(stderr + "\n" + stdout); limit != "" {
+		e.Kind = KindResourceLimit
+		e.Err = &LimitError{Limit: limit, Err: err}
+	}
+	return e
+}
+
+// limitPatterns maps lower-cased substrings of CLI output to the limits that
+// cause them.
+var limitPatterns = []struct {
+	limit    Limit
+	patterns []string
+}{
+	{LimitOpenFiles, []string{"emfile", "too many open files"}},
+	{LimitAddressSpace, []string{"out of memory", "allocation failed", "cannot allocate memory", "enomem"}},
+	{LimitProcesses, []string{"spawn eagain", "resource temporarily unavailable", "fork: retry"}},
+}
+
+// fromOutput returns the limit of l that output reports as reached, if any.
+func (l ResourceLimits) fromOutput(output string) Limit {
+	set := map[Limit]bool{
+		LimitOpenFiles:    l.OpenFiles > 0,
+		LimitAddressSpace: l.AddressSpace > 0,
+		LimitProcesses:    l.Processes > 0,
+	}
+	lower := strings.ToLower(output)
+	for _, lp := range limitPatterns {
+		if !set[lp.limit] {
+			continue
+		}
+		for _, p := range lp.patterns {
+			if strings.Contains(lower, p) {
+				return lp.limit
+			}
+		}
+	}
+	return ""
+}
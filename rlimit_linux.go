@@ -0,0 +1,261 @@
+//go:build linux
+
+package claude
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// rlimitNproc is RLIMIT_NPROC, which package syscall does not define.
+var rlimitNproc = func() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 8
+	}
+	return 6
+}()
+
+// cgroupSeq numbers the cgroups created by this process.
+var cgroupSeq atomic.Int64
+
+// cgroupReleaseTimeout bounds the wait for the processes of a cgroup to exit
+// before it is removed.
+const cgroupReleaseTimeout = 5 * time.Second
+
+// appliedLimits are the limits of a running process.
+type appliedLimits struct {
+	limits *ResourceLimits
+	// cgroup is the process's own cgroup, if it could be joined.
+	cgroup string
+}
+
+// limitShim runs the CLI once its limits are in place: it waits for a line on
+// file descriptor 3 and then execs the CLI, which inherits its rlimits and
+// cgroup.
+const limitShim = `read -r _ <&3 || exit 1; exec 3<&-; exec "$0" "$@"`
+
+// startLimited starts the process of cmd with its resource limits in place
+// before the CLI runs. The process starts as a shell that waits until its
+// rlimits are set, and is then let go to exec the CLI. It is started in its
+// cgroup, or moved there before it is let go where the kernel cannot start
+// processes in a cgroup.
+func startLimited(cmd *Command) (*exec.Cmd, *appliedLimits, error) {
+	l := cmd.Limits
+	if l == nil || l.isZero() {
+		c := execCommand(cmd)
+		return c, nil, c.Start()
+	}
+
+	a := &appliedLimits{limits: l}
+	if l.Cgroup != "" {
+		a.cgroup = createCgroup(l)
+	}
+	c, err := a.start(cmd, a.cgroup != "")
+	if err != nil && a.cgroup != "" && !errors.Is(err, exec.ErrNotFound) && !errors.Is(err, fs.ErrNotExist) {
+		// Starting in a cgroup needs clone3 (Linux 5.7).
+		c, err = a.start(cmd, false)
+	}
+	if err != nil {
+		a.release()
+		return nil, nil, err
+	}
+	return c, a, nil
+}
+
+// start starts cmd through limitShim, in a's cgroup if inCgroup is set, and
+// lets it exec the CLI once its limits are set.
+func (a *appliedLimits) start(cmd *Command, inCgroup bool) (*exec.Cmd, error) {
+	c := execCommand(cmd)
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	c.Args = append([]string{"sh", "-c", limitShim, c.Path}, cmd.Args...)
+	c.Path = "/bin/sh"
+	if inCgroup {
+		dir, err := os.Open(a.cgroup)
+		if err != nil {
+			return nil, err
+		}
+		defer dir.Close()
+		if c.SysProcAttr == nil {
+			c.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		c.SysProcAttr.UseCgroupFD = true
+		c.SysProcAttr.CgroupFD = int(dir.Fd())
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	c.ExtraFiles = []*os.File{r}
+
+	err = c.Start()
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err = a.apply(c.Process.Pid, inCgroup); err == nil {
+		_, err = w.WriteString("\n")
+	}
+	if err != nil {
+		c.Process.Kill()
+		c.Wait()
+		return nil, err
+	}
+	return c, nil
+}
+
+// apply sets the rlimits of the waiting process pid and, unless it was
+// started in its cgroup, moves it there.
+func (a *appliedLimits) apply(pid int, inCgroup bool) error {
+	l := a.limits
+	if l.CPUTime > 0 {
+		secs := uint64((l.CPUTime + 999_999_999) / 1_000_000_000)
+		// SIGXCPU at the soft limit, SIGKILL one second later.
+		if err := prlimit(pid, syscall.RLIMIT_CPU, secs, secs+1); err != nil {
+			return fmt.Errorf("claude: set cpu time limit: %w", err)
+		}
+	}
+	for _, rl := range []struct {
+		resource int
+		value    uint64
+		name     Limit
+	}{
+		{syscall.RLIMIT_AS, l.AddressSpace, LimitAddressSpace},
+		{syscall.RLIMIT_NOFILE, l.OpenFiles, LimitOpenFiles},
+		{rlimitNproc, l.Processes, LimitProcesses},
+	} {
+		if rl.value == 0 {
+			continue
+		}
+		if err := prlimit(pid, rl.resource, rl.value, rl.value); err != nil {
+			return fmt.Errorf("claude: set %s limit: %w", rl.name, err)
+		}
+	}
+
+	if a.cgroup != "" && !inCgroup {
+		if err := os.WriteFile(filepath.Join(a.cgroup, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+			os.Remove(a.cgroup)
+			a.cgroup = ""
+		}
+	}
+	return nil
+}
+
+func prlimit(pid, resource int, soft, hard uint64) error {
+	lim := syscall.Rlimit{Cur: soft, Max: hard}
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(&lim)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// createCgroup creates a child cgroup of l.Cgroup and sets its limits. It
+// returns the cgroup's path, or "" if it could not be created.
+func createCgroup(l *ResourceLimits) string {
+	dir := filepath.Join(l.Cgroup, fmt.Sprintf("claude-%d-%d", os.Getpid(), cgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return ""
+	}
+	// The controllers may not be enabled for the subtree; the process is
+	// still placed in the cgroup then.
+	if l.MemoryMax > 0 {
+		os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatUint(l.MemoryMax, 10)), 0o644)
+	}
+	if l.Processes > 0 {
+		os.WriteFile(filepath.Join(dir, "pids.max"), []byte(strconv.FormatUint(l.Processes, 10)), 0o644)
+	}
+	return dir
+}
+
+// check returns err, or a *LimitError wrapping it if the process was stopped
+// by one of its limits.
+func (a *appliedLimits) check(err error) error {
+	if a == nil || err == nil {
+		return err
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && a.limits.CPUTime > 0 {
+		ws, _ := exitErr.Sys().(syscall.WaitStatus)
+		used := exitErr.UserTime() + exitErr.SystemTime()
+		if ws.Signaled() && (ws.Signal() == syscall.SIGXCPU || ws.Signal() == syscall.SIGKILL && used >= a.limits.CPUTime) {
+			return &LimitError{Limit: LimitCPUTime, Err: err}
+		}
+	}
+	if a.cgroup != "" {
+		if cgroupEvents(a.cgroup, "memory.events", "oom_kill") > 0 {
+			return &LimitError{Limit: LimitMemory, Err: err}
+		}
+		if cgroupEvents(a.cgroup, "pids.events", "max") > 0 {
+			return &LimitError{Limit: LimitProcesses, Err: err}
+		}
+	}
+	return err
+}
+
+// release kills the processes left in the cgroup, waits for them to exit and
+// removes the cgroup.
+func (a *appliedLimits) release() {
+	if a == nil || a.cgroup == "" {
+		return
+	}
+	// Only a cgroup has cgroup.events; there is nothing to wait for in a
+	// plain directory.
+	if _, err := os.Stat(filepath.Join(a.cgroup, "cgroup.events")); err == nil {
+		if f, err := os.OpenFile(filepath.Join(a.cgroup, "cgroup.kill"), os.O_WRONLY, 0); err == nil {
+			f.WriteString("1")
+			f.Close()
+		} else {
+			// cgroup.kill is new in Linux 5.14.
+			killCgroupProcs(a.cgroup)
+		}
+		deadline := time.Now().Add(cgroupReleaseTimeout)
+		for cgroupEvents(a.cgroup, "cgroup.events", "populated") > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	os.Remove(a.cgroup)
+}
+
+// killCgroupProcs kills the processes listed in the cgroup dir.
+func killCgroupProcs(dir string) {
+	data, _ := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
+// cgroupEvents returns the counter key of the events file name in dir.
+func cgroupEvents(dir, name, key string) int {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), " ")
+		if ok && k == key {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+//go:build linux
+
+package claude
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestExecRunnerAppliesLimits(t *testing.T) {
+	cli := writeFakeCLI(t, `echo "$(ulimit -n) $(ulimit -v) $(ulimit -t)"`)
+	var out bytes.Buffer
+	err := ExecRunner{}.Run(context.Background(), &Command{Path: cli, Stdout: &out, Limits: &ResourceLimits{
+		OpenFiles:    64,
+		AddressSpace: 4 << 30,
+		CPUTime:      1500 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(out.String()), "64 4194304 2"; got != want {
+		t.Errorf("ulimit -n -v -t = %q, want %q", got, want)
+	}
+}
+
+func TestCPUTimeLimit(t *testing.T) {
+	cli := writeFakeCLI(t, `while :; do :; done`)
+	c := NewClient(WithCLIPath(cli), WithResourceLimits(ResourceLimits{CPUTime: time.Second}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := c.AskJSON(ctx, "hi")
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitCPUTime || !errors.Is(err, ErrResourceLimit) {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(err.Error(), "cpu time limit reached") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestCgroupPlacement(t *testing.T) {
+	// A plain directory stands in for a delegated cgroup; the script reports
+	// an OOM kill the way the kernel would.
+	root := t.TempDir()
+	cli := writeFakeCLI(t, `cg=$(echo "`+root+`"/claude-*)
+echo $$
+for f in cgroup.procs pids.max memory.max; do echo "$(cat "$cg/$f")"; done
+echo "oom_kill 1" > "$cg/memory.events"
+kill -9 $$`)
+	var out bytes.Buffer
+	err := ExecRunner{}.Run(context.Background(), &Command{Path: cli, Stdout: &out, Limits: &ResourceLimits{
+		Cgroup:    root,
+		Processes: 32,
+		MemoryMax: 1 << 30,
+	}})
+
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitMemory {
+		t.Fatalf("err = %v", err)
+	}
+	lines := strings.Fields(out.String())
+	if len(lines) != 4 || lines[1] != lines[0] || lines[2] != "32" || lines[3] != "1073741824" {
+		t.Errorf("pid, cgroup files = %q", lines)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, "claude-*", "cgroup.kill")); len(matches) != 0 {
+		t.Error("cgroup.kill was created outside a cgroup")
+	}
+}
+
+func TestLimitsWithPtraceDenied(t *testing.T) {
+	// A seccomp filter on this thread, inherited by the processes it starts,
+	// makes ptrace fail with EPERM, as under a debugger or a container
+	// profile. The thread exits with the goroutine that locked it.
+	cli := writeFakeCLI(t, `echo "$(ulimit -n)"`)
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		if err := denyPtrace(); err != nil {
+			done <- err
+			return
+		}
+		done <- ExecRunner{}.Run(context.Background(), &Command{Path: cli, Stdout: &out, Limits: &ResourceLimits{OpenFiles: 64}})
+	}()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "64" {
+		t.Errorf("ulimit -n = %q, want 64", got)
+	}
+}
+
+// denyPtrace installs a seccomp filter on the calling thread that fails ptrace
+// with EPERM.
+func denyPtrace() error {
+	filter := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 0},
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: 0, Jf: 1, K: syscall.SYS_PTRACE},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: 0x00050000 | uint32(syscall.EPERM)}, // SECCOMP_RET_ERRNO
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: 0x7fff0000},                         // SECCOMP_RET_ALLOW
+	}
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	// PR_SET_NO_NEW_PRIVS
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, 38, 1, 0, 0, 0, 0); errno != 0 {
+		return errno
+	}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, 2, uintptr(unsafe.Pointer(&prog)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package claude
+
+import "os/exec"
+
+// appliedLimits is empty: resource limits are only applied on Linux.
+type appliedLimits struct{}
+
+// startLimited starts the process of cmd, ignoring its resource limits.
+func startLimited(cmd *Command) (*exec.Cmd, *appliedLimits, error) {
+	c := execCommand(cmd)
+	return c, nil, c.Start()
+}
+
+func (a *appliedLimits) check(err error) error {
+	return err
+}
+
+func (a *appliedLimits) release() {}
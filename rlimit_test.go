@@ -0,0 +1,63 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWallClockTimeout(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c := NewClient(WithRunner(r), WithWallClockTimeout(20*time.Millisecond))
+
+	for name, call := range map[string]func() error{
+		"AskJSON": func() error { _, err := c.AskJSON(context.Background(), "hi"); return err },
+		"Stream":  func() error { _, err := c.Stream(context.Background(), "hi").Result(); return err },
+	} {
+		err := call()
+		var lerr *LimitError
+		if !errors.Is(err, ErrResourceLimit) || errors.Is(err, ErrCanceled) || !errors.As(err, &lerr) || lerr.Limit != LimitWallClock {
+			t.Errorf("%s: err = %v", name, err)
+			continue
+		}
+		if want := "claude: resource limit exceeded: wall-clock time limit reached: context deadline exceeded"; err.Error() != want {
+			t.Errorf("%s: Error() = %q, want %q", name, err.Error(), want)
+		}
+	}
+
+	// The caller's own context still reports a cancellation.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.With(WithWallClockTimeout(time.Minute)).Ask(ctx, "hi"); !errors.Is(err, ErrCanceled) {
+		t.Errorf("err = %v, want ErrCanceled", err)
+	}
+}
+
+func TestResourceLimitFromOutput(t *testing.T) {
+	var limits *ResourceLimits
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		limits = cmd.Limits
+		io.WriteString(cmd.Stderr, "Error: EMFILE: too many open files, open '/tmp/x'")
+		return &ExitError{Code: 1}
+	})
+
+	_, err := NewClient(WithRunner(r), WithResourceLimits(ResourceLimits{OpenFiles: 64})).Ask(context.Background(), "hi")
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != LimitOpenFiles || !errors.Is(err, ErrResourceLimit) {
+		t.Errorf("err = %v", err)
+	}
+	if limits == nil || limits.OpenFiles != 64 {
+		t.Errorf("command limits = %+v", limits)
+	}
+
+	// Without the limit, the output is not attributed to it.
+	_, err = NewClient(WithRunner(r)).Ask(context.Background(), "hi")
+	if errors.Is(err, ErrResourceLimit) || limits != nil {
+		t.Errorf("err = %v, limits = %+v", err, limits)
+	}
+}
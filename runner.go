@@ -0,0 +1,222 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Command describes a single CLI invocation handed to a Runner.
+type Command struct {
+	// Path is the CLI executable, as set by WithCLIPath.
+	Path string
+	// Args are the CLI arguments, excluding Path.
+	Args []string
+	// Dir is the working directory; empty means the current directory.
+	Dir string
+	// Env is the process environment; nil means the current environment.
+	Env []string
+	// Limits are the resource limits set with WithResourceLimits, or nil.
+	Limits *ResourceLimits
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs CLI processes for a Client. Every Client method, streaming
+// included, goes through the Runner, so it can be replaced to fake output,
+// wrap the command in a sandbox, or run it elsewhere.
+//
+// Run must block until the process has exited and all of its output has been
+// written, and must stop the process when ctx is done. A non-zero exit status
+// should be reported as an error with an ExitCode() int method, such as
+// *exec.ExitError or *ExitError, so that it can be classified.
+type Runner interface {
+	Run(ctx context.Context, cmd *Command) error
+}
+
+// RunnerFunc adapts an ordinary function to the Runner interface.
+type RunnerFunc func(ctx context.Context, cmd *Command) error
+
+// Run calls f(ctx, cmd).
+func (f RunnerFunc) Run(ctx context.Context, cmd *Command) error {
+	return f(ctx, cmd)
+}
+
+// LocalRunner is implemented by Runners that start the CLI as a process on
+// this host, with access to its file system and programs. WithHooks requires
+// one, because the CLI reaches the hook handlers through a Unix socket and
+// curl. ExecRunner is a LocalRunner; a Runner that wraps the CLI in a
+// sandbox, or runs it elsewhere, is not.
+type LocalRunner interface {
+	Runner
+	// Local reports whether the CLI runs on this host.
+	Local() bool
+}
+
+// DefaultGracePeriod is how long ExecRunner waits for a process to exit after
+// signalling it, before killing it.
+const DefaultGracePeriod = 5 * time.Second
+
+// outputWaitDelay is how long ExecRunner reads the output of an exited CLI
+// before it closes the pipes held open by processes it could not kill.
+const outputWaitDelay = 10 * time.Second
+
+// ExecRunner runs commands as local processes with os/exec. It is the
+// default Runner.
+//
+// On Unix systems the CLI is started in its own process group. When the
+// context ends, Signal is sent to the whole group, so that the tools, MCP
+// servers and other processes started by the agent stop too; processes still
+// running after GracePeriod are killed with SIGKILL. Run then returns a
+// *TerminatedError naming the signal that stopped the process. Elsewhere the
+// process is killed at once.
+//
+// When the CLI exits on its own, the processes left in its group are killed
+// too. Because the group does not receive the terminal's Ctrl-C, on Linux the
+// CLI is killed when the Go program dies without cancelling the call; on
+// other systems it keeps running.
+//
+// On Linux, the Command's resource limits are applied before the CLI runs
+// (see ResourceLimits), and a process stopped by one of them fails with a
+// *LimitError.
+type ExecRunner struct {
+	// Signal is sent first when the context ends. Nil means SIGTERM, or
+	// SIGKILL where process groups are not used.
+	Signal os.Signal
+	// GracePeriod is how long to wait after Signal before sending SIGKILL.
+	// Zero means DefaultGracePeriod; a negative value sends SIGKILL at once.
+	GracePeriod time.Duration
+}
+
+// Local reports true: ExecRunner runs the CLI on this host.
+func (ExecRunner) Local() bool {
+	return true
+}
+
+// Run starts cmd and waits for it to exit.
+func (r ExecRunner) Run(ctx context.Context, cmd *Command) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c, limits, err := startLimited(cmd)
+	if err != nil {
+		return err
+	}
+	defer limits.release()
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- c.Wait() }()
+	// Kill what the CLI leaves behind as soon as it exits, so that children
+	// holding its output open do not keep Wait from returning.
+	go func() {
+		if waitExit(c.Process) {
+			signalGroup(c.Process, killSignal)
+		}
+	}()
+
+	select {
+	case err := <-waitErr:
+		signalGroup(c.Process, killSignal)
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// The CLI succeeded; a child outside its group kept the output
+			// open.
+			err = nil
+		}
+		return limits.check(err)
+	case <-ctx.Done():
+	}
+
+	grace := r.GracePeriod
+	if grace == 0 {
+		grace = DefaultGracePeriod
+	}
+	sig := r.Signal
+	if sig == nil {
+		sig = defaultSignal
+	}
+	if grace > 0 && signalGroup(c.Process, sig) == nil {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-waitErr:
+			// Kill whatever the process left behind in its group.
+			signalGroup(c.Process, killSignal)
+			return &TerminatedError{Signal: sig, Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+	signalGroup(c.Process, killSignal)
+	<-waitErr
+	return &TerminatedError{Signal: killSignal, GracePeriod: max(grace, 0), Err: ctx.Err()}
+}
+
+// execCommand returns the command that runs cmd in its own process group.
+func execCommand(cmd *Command) *exec.Cmd {
+	c := exec.Command(cmd.Path, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Env = cmd.Env
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	c.WaitDelay = outputWaitDelay
+	setProcessGroup(c)
+	return c
+}
+
+// TerminatedError is returned by ExecRunner when it stopped a process because
+// the context ended. It unwraps to the context's error.
+type TerminatedError struct {
+	// Signal is the signal that stopped the process: ExecRunner.Signal, or
+	// SIGKILL when the process did not exit within the grace period.
+	Signal os.Signal
+	// GracePeriod is the time waited before SIGKILL, if it was sent.
+	GracePeriod time.Duration
+	Err         error
+}
+
+func (e *TerminatedError) Error() string {
+	if e.Signal == killSignal && e.GracePeriod > 0 {
+		return fmt.Sprintf("process killed with %s after %v grace period: %v", signalName(e.Signal), e.GracePeriod, e.Err)
+	}
+	return fmt.Sprintf("process stopped with %s: %v", signalName(e.Signal), e.Err)
+}
+
+// Unwrap returns the context's error.
+func (e *TerminatedError) Unwrap() error {
+	return e.Err
+}
+
+// PrefixRunner returns a Runner that runs every command through prefix, for
+// example a sandbox wrapper: PrefixRunner(ExecRunner{}, "firejail", "--quiet").
+// The original executable becomes the first argument after the prefix.
+func PrefixRunner(r Runner, prefix ...string) Runner {
+	if len(prefix) == 0 {
+		return r
+	}
+	return RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		wrapped := *cmd
+		wrapped.Path = prefix[0]
+		wrapped.Args = append(append(append([]string(nil), prefix[1:]...), cmd.Path), cmd.Args...)
+		return r.Run(ctx, &wrapped)
+	})
+}
+
+// ExitError reports a non-zero exit status from a Runner that does not use
+// os/exec.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit status.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package claude
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Without process groups, the process is killed at once by default.
+var (
+	defaultSignal = os.Kill
+	killSignal    = os.Kill
+)
+
+// setProcessGroup does nothing: process groups are only used on Unix.
+func setProcessGroup(c *exec.Cmd) {}
+
+// signalGroup sends sig to p alone.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
+
+func signalName(sig os.Signal) string {
+	if sig == os.Kill {
+		return "SIGKILL"
+	}
+	return sig.String()
+}
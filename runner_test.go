@@ -0,0 +1,83 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRunnerReceivesCommand(t *testing.T) {
+	var got *Command
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		got = cmd
+		io.WriteString(cmd.Stdout, "  hello\n")
+		return nil
+	})
+	c := NewClient(WithRunner(r), WithCLIPath("/opt/claude"), WithWorkDir("/work"), WithModel("haiku"))
+
+	out, err := c.Ask(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hello" {
+		t.Errorf("out = %q", out)
+	}
+	if got.Path != "/opt/claude" || got.Dir != "/work" {
+		t.Errorf("command = %+v", got)
+	}
+	assertArgs(t, []string{"-p", "hi", "--output-format", "text", "--model", "haiku"}, got.Args)
+}
+
+func TestRunnerStream(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"system","subtype":"init","session_id":"s1","model":"haiku"}`+"\n")
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"done","session_id":"s1"}`+"\n")
+		return nil
+	})
+	c := NewClient(WithRunner(r))
+
+	resp, err := c.Stream(context.Background(), "hi").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "done" || resp.Model != "haiku" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestRunnerExitError(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stderr, "API Error: 429 rate limit exceeded")
+		return &ExitError{Code: 2}
+	})
+	c := NewClient(WithRunner(r))
+
+	for name, call := range map[string]func() error{
+		"Ask":    func() error { _, err := c.Ask(context.Background(), "hi"); return err },
+		"Stream": func() error { _, err := c.Stream(context.Background(), "hi").Result(); return err },
+	} {
+		err := call()
+		var cerr *Error
+		if !errors.As(err, &cerr) || cerr.ExitCode != 2 || !errors.Is(err, ErrRateLimited) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestPrefixRunner(t *testing.T) {
+	var got *Command
+	inner := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		got = cmd
+		return nil
+	})
+	c := NewClient(WithRunner(PrefixRunner(inner, "bwrap", "--ro-bind", "/", "/")))
+
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "bwrap" {
+		t.Errorf("path = %q", got.Path)
+	}
+	assertArgs(t, []string{"--ro-bind", "/", "/", "claude", "-p", "hi", "--output-format", "text"}, got.Args)
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package claude
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var (
+	defaultSignal os.Signal = syscall.SIGTERM
+	killSignal    os.Signal = syscall.SIGKILL
+)
+
+// setProcessGroup makes c the leader of a new process group, which its
+// children join. The group no longer receives the terminal's Ctrl-C, so on
+// Linux the process is also killed when the Go program dies.
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setDeathSignal(c.SysProcAttr)
+}
+
+// signalGroup sends sig to the process group led by p.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
+
+// signalNames holds the names of the signals commonly used to stop a process.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+func signalName(sig os.Signal) string {
+	if s, ok := sig.(syscall.Signal); ok {
+		if name, ok := signalNames[s]; ok {
+			return name
+		}
+	}
+	return sig.String()
+}
@@ -0,0 +1,149 @@
+//go:build unix
+
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startChild runs script with ExecRunner until the process it starts in the
+// background has written its PID, then cancels the call. It returns the error
+// and the child's PID.
+func startChild(t *testing.T, r ExecRunner, script string) (error, int) {
+	t.Helper()
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cli := writeFakeCLI(t, strings.ReplaceAll(script, "PIDFILE", pidFile))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(ctx, &Command{Path: cli})
+	}()
+	var pid int
+	waitFor(t, "child process", func() bool {
+		data, err := os.ReadFile(pidFile)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil && pid > 0
+	})
+	cancel()
+	return <-done, pid
+}
+
+// waitGone waits until the process pid has exited. Exited processes that
+// have not been reaped yet count as gone, because the orphaned children of
+// the script are reaped by init, which may be slow in containers.
+func waitGone(t *testing.T, pid int) {
+	t.Helper()
+	waitFor(t, "process "+strconv.Itoa(pid)+" to exit", func() bool {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			return true
+		}
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		// The state follows the command name in parentheses.
+		i := strings.LastIndexByte(string(stat), ')')
+		return err == nil && i >= 0 && strings.HasPrefix(string(stat[i+1:]), " Z")
+	})
+}
+
+func TestExecRunnerSignalsProcessGroup(t *testing.T) {
+	err, pid := startChild(t, ExecRunner{Signal: syscall.SIGINT}, "sleep 30 &\necho $! > PIDFILE\nwait\n")
+
+	var terr *TerminatedError
+	if !errors.As(err, &terr) || terr.Signal != syscall.SIGINT || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if want := "process stopped with SIGINT: context canceled"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	waitGone(t, pid)
+}
+
+func TestExecRunnerKillsAfterGracePeriod(t *testing.T) {
+	start := time.Now()
+	err, pid := startChild(t, ExecRunner{GracePeriod: 100 * time.Millisecond},
+		"trap '' TERM\nsleep 30 &\necho $! > PIDFILE\nwait\n")
+
+	var terr *TerminatedError
+	if !errors.As(err, &terr) || terr.Signal != syscall.SIGKILL || terr.GracePeriod != 100*time.Millisecond {
+		t.Fatalf("err = %v", err)
+	}
+	if !strings.Contains(err.Error(), "killed with SIGKILL after 100ms grace period") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("SIGKILL sent before the grace period ended")
+	}
+	waitGone(t, pid)
+}
+
+func TestExecRunnerCanceledErrorNamesSignal(t *testing.T) {
+	cli := writeFakeCLI(t, `exec sleep 10`)
+	c := NewClient(WithCLIPath(cli), WithRunner(ExecRunner{GracePeriod: -1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Ask(ctx, "hi")
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if want := "claude: canceled: process stopped with SIGKILL: context deadline exceeded"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestStreamCanceledErrorNamesSignal(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+echo '{"type":"assistant","message":{"content":[]}}'
+exec sleep 10`)
+	c := NewClient(WithCLIPath(cli), WithRunner(ExecRunner{}))
+
+	// The consumer stops reading and cancels, as when an HTTP client
+	// disconnects, while the next event is waiting to be sent.
+	ctx, cancel := context.WithCancel(context.Background())
+	s := c.Stream(ctx, "hi")
+	<-s.Events()
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	_, err := s.Result()
+
+	var terr *TerminatedError
+	if !errors.As(err, &terr) || terr.Signal != syscall.SIGTERM || !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if want := "claude: canceled: process stopped with SIGTERM: context canceled"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestExecRunnerKillsGroupAfterExit(t *testing.T) {
+	// The background child keeps the CLI's stdout open.
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cli := writeFakeCLI(t, "sleep 30 &\necho $! > "+pidFile+"\necho done\n")
+	var out strings.Builder
+	done := make(chan error, 1)
+	go func() {
+		done <- ExecRunner{}.Run(context.Background(), &Command{Path: cli, Stdout: &out})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(outputWaitDelay / 2):
+		t.Fatal("Run did not return while a child held stdout open")
+	}
+	if strings.TrimSpace(out.String()) != "done" {
+		t.Errorf("output = %q", out.String())
+	}
+	data, _ := os.ReadFile(pidFile)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	waitGone(t, pid)
+}
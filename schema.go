@@ -0,0 +1,432 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonSchema is the subset of JSON Schema that this package generates and validates.
+type jsonSchema struct {
+	Type                 schemaType             `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *additional            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Const                any                    `json:"const,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+}
+
+// schemaType is the "type" keyword, which may be a single name or a list.
+type schemaType []string
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = schemaType{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// additional is the "additionalProperties" keyword: a boolean or a schema.
+type additional struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (a additional) MarshalJSON() ([]byte, error) {
+	if a.schema != nil {
+		return json.Marshal(a.schema)
+	}
+	return json.Marshal(a.allowed)
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(data, &a.schema)
+}
+
+var (
+	schemaCache sync.Map // reflect.Type -> string
+
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// SchemaFor derives a JSON schema from T, which must be a struct type.
+//
+// Property names follow the encoding/json rules. Constraints are read from the
+// `jsonschema` struct tag as a comma-separated list:
+//
+//	required              the property must be present
+//	enum=a|b|c            allowed values
+//	min=N, max=N          minimum/maximum for numbers, length bounds for
+//	                      strings and item counts for slices
+//	description=...       property description; must come last and may
+//	                      contain commas
+//
+// Objects are generated with additionalProperties set to false.
+func SchemaFor[T any]() (string, error) {
+	return schemaForType(reflect.TypeFor[T]())
+}
+
+func schemaForType(t reflect.Type) (string, error) {
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(string), nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("claude: schema type must be a struct, got %s", t)
+	}
+
+	s, err := schemaOf(t, map[reflect.Type]bool{})
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("claude: marshal schema: %w", err)
+	}
+	schemaCache.Store(t, string(data))
+	return string(data), nil
+}
+
+// schemaOf builds the schema for t. visiting guards against recursive types,
+// which cannot be expressed without $ref.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) (*jsonSchema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &jsonSchema{Type: schemaType{"string"}, Format: "date-time"}, nil
+	case t == rawMessageType:
+		return &jsonSchema{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &jsonSchema{Type: schemaType{"string"}}, nil
+	case reflect.Bool:
+		return &jsonSchema{Type: schemaType{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: schemaType{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: schemaType{"number"}}, nil
+	case reflect.Interface:
+		return &jsonSchema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: schemaType{"string"}}, nil
+		}
+		items, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: schemaType{"array"}, Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("claude: unsupported map key type %s", t.Key())
+		}
+		values, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: schemaType{"object"}, AdditionalProperties: &additional{allowed: true, schema: values}}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			return nil, fmt.Errorf("claude: recursive type %s is not supported", t)
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		s := &jsonSchema{
+			Type:                 schemaType{"object"},
+			Properties:           map[string]*jsonSchema{},
+			AdditionalProperties: &additional{allowed: false},
+		}
+		if err := addFields(s, t, visiting); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("claude: unsupported type %s", t)
+	}
+}
+
+// addFields adds the properties of struct type t to s, flattening embedded
+// structs the way encoding/json does: of the fields with the same name, the
+// least nested one wins, then the one named by a json tag; if that leaves
+// more than one, the name is dropped.
+func addFields(s *jsonSchema, t reflect.Type, visiting map[reflect.Type]bool) error {
+	var fields []schemaField
+	if err := collectFields(&fields, t, 0, visiting); err != nil {
+		return err
+	}
+	byName := map[string][]*schemaField{}
+	for i := range fields {
+		byName[fields[i].name] = append(byName[fields[i].name], &fields[i])
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		if f != dominantField(byName[f.name]) {
+			continue
+		}
+		prop, err := schemaOf(f.field.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("%w (field %s.%s)", err, f.parent.Name(), f.field.Name)
+		}
+		required, err := applySchemaTag(prop, f.field.Tag.Get("jsonschema"))
+		if err != nil {
+			return fmt.Errorf("claude: field %s.%s: %w", f.parent.Name(), f.field.Name, err)
+		}
+		s.Properties[f.name] = prop
+		if required {
+			s.Required = append(s.Required, f.name)
+		}
+	}
+	return nil
+}
+
+// schemaField is a JSON property of a struct, possibly promoted from an
+// embedded struct.
+type schemaField struct {
+	name   string
+	depth  int
+	tagged bool
+	parent reflect.Type
+	field  reflect.StructField
+}
+
+// collectFields appends the fields of struct type t, nested depth embedded
+// structs deep, and those of its embedded structs to fields.
+func collectFields(fields *[]schemaField, t reflect.Type, depth int, visiting map[reflect.Type]bool) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, tagged := jsonFieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+			if visiting[ft] {
+				return fmt.Errorf("claude: recursive type %s is not supported", ft)
+			}
+			visiting[ft] = true
+			err := collectFields(fields, ft, depth+1, visiting)
+			delete(visiting, ft)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		*fields = append(*fields, schemaField{name: name, depth: depth, tagged: tagged, parent: t, field: f})
+	}
+	return nil
+}
+
+// dominantField returns the field that encoding/json uses among fields of
+// the same name, or nil if there is none.
+func dominantField(fields []*schemaField) *schemaField {
+	var dominant []*schemaField
+	for _, f := range fields {
+		switch {
+		case len(dominant) == 0 || f.depth < dominant[0].depth:
+			dominant = []*schemaField{f}
+		case f.depth == dominant[0].depth:
+			dominant = append(dominant, f)
+		}
+	}
+	if len(dominant) > 1 {
+		var tagged []*schemaField
+		for _, f := range dominant {
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+		dominant = tagged
+	}
+	if len(dominant) != 1 {
+		return nil
+	}
+	return dominant[0]
+}
+
+// jsonFieldName returns the JSON property name of f and whether it was set
+// explicitly in the json tag. It returns "-" for skipped fields.
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "-", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name != "" {
+		return name, true
+	}
+	return f.Name, false
+}
+
+// applySchemaTag applies the constraints of a `jsonschema` tag to s and
+// reports whether the property is required.
+func applySchemaTag(s *jsonSchema, tag string) (bool, error) {
+	required := false
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, "description=") {
+			item, tag = tag, ""
+		} else {
+			item, tag, _ = strings.Cut(tag, ",")
+		}
+
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "":
+		case "required":
+			required = true
+		case "description":
+			s.Description = value
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				ev, err := enumValue(s, v)
+				if err != nil {
+					return false, err
+				}
+				s.Enum = append(s.Enum, ev)
+			}
+		case "min", "max":
+			if err := applyBound(s, key, value); err != nil {
+				return false, err
+			}
+		default:
+			return false, fmt.Errorf("unknown jsonschema tag option %q", key)
+		}
+	}
+	return required, nil
+}
+
+// enumValue converts an enum tag value to the property's JSON type.
+func enumValue(s *jsonSchema, v string) (any, error) {
+	if len(s.Type) == 0 {
+		return v, nil
+	}
+	switch s.Type[0] {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid numeric enum value %q", v)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean enum value %q", v)
+		}
+		return b, nil
+	}
+	return v, nil
+}
+
+// applyBound maps min/max onto the keyword matching the property's type.
+func applyBound(s *jsonSchema, key, value string) error {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q", key, value)
+	}
+	typ := ""
+	if len(s.Type) > 0 {
+		typ = s.Type[0]
+	}
+
+	isMin := key == "min"
+	switch typ {
+	case "integer", "number":
+		if isMin {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	case "string":
+		if isMin {
+			s.MinLength = ptr(int(n))
+		} else {
+			s.MaxLength = ptr(int(n))
+		}
+	case "array":
+		if isMin {
+			s.MinItems = ptr(int(n))
+		} else {
+			s.MaxItems = ptr(int(n))
+		}
+	default:
+		return fmt.Errorf("%s is not supported for type %q", key, typ)
+	}
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// AskInto runs the prompt with a JSON schema derived from T (see SchemaFor)
+// and decodes the structured result into a T. If the result does not match
+// the schema, a *ValidationError is returned along with the Response.
+// Schema repair configured with WithSchemaRepair applies as in AskWithSchema.
+func AskInto[T any](ctx context.Context, c *Client, prompt string, opts ...CallOption) (T, *Response, error) {
+	var v T
+	schema, err := SchemaFor[T]()
+	if err != nil {
+		return v, nil, err
+	}
+
+	resp, err := c.AskWithSchema(ctx, prompt, schema, opts...)
+	if err != nil {
+		return v, resp, err
+	}
+	if err := decodeResult(resp.Result, &v); err != nil {
+		return v, resp, err
+	}
+	return v, resp, nil
+}
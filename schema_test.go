@@ -0,0 +1,191 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type schemaTestItem struct {
+	Name string `json:"name" jsonschema:"required"`
+}
+
+type schemaTestResult struct {
+	Correct bool             `json:"correct" jsonschema:"required,description=Whether the answer is correct"`
+	Score   int              `json:"score" jsonschema:"required,min=0,max=100,description=Score, from 0 to 100"`
+	Level   string           `json:"level,omitempty" jsonschema:"enum=easy|hard"`
+	Tags    []string         `json:"tags" jsonschema:"max=3"`
+	Items   []schemaTestItem `json:"items"`
+	Skipped string           `json:"-"`
+	hidden  string
+}
+
+type schemaTestEmbedded struct {
+	*schemaTestEmbedded
+	Name string `json:"name"`
+}
+
+type schemaTestBase struct {
+	ID   string `jsonschema:"required"`
+	Note string `jsonschema:"required"`
+}
+
+type schemaTestOther struct {
+	Note string
+}
+
+type schemaTestShadow struct {
+	schemaTestBase
+	schemaTestOther
+	ID int `jsonschema:"required"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := SchemaFor[schemaTestResult]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"type":"object","properties":{` +
+		`"correct":{"type":"boolean","description":"Whether the answer is correct"},` +
+		`"items":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"],"additionalProperties":false}},` +
+		`"level":{"type":"string","enum":["easy","hard"]},` +
+		`"score":{"type":"integer","description":"Score, from 0 to 100","minimum":0,"maximum":100},` +
+		`"tags":{"type":"array","items":{"type":"string"},"maxItems":3}},` +
+		`"required":["correct","score"],"additionalProperties":false}`
+	if schema != want {
+		t.Errorf("schema mismatch\ngot:  %s\nwant: %s", schema, want)
+	}
+}
+
+func TestSchemaForShadowedFields(t *testing.T) {
+	// As in encoding/json, the outer ID hides the embedded one and the two
+	// embedded Notes cancel out.
+	schema, err := SchemaFor[schemaTestShadow]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{"ID":{"type":"integer"}},"required":["ID"],"additionalProperties":false}`
+	if schema != want {
+		t.Errorf("schema mismatch\ngot:  %s\nwant: %s", schema, want)
+	}
+}
+
+func TestSchemaForRejectsNonStruct(t *testing.T) {
+	if _, err := SchemaFor[string](); err == nil {
+		t.Error("expected error for non-struct type")
+	}
+}
+
+func TestSchemaForRejectsRecursion(t *testing.T) {
+	type node struct {
+		Children []node `json:"children"`
+	}
+	if _, err := SchemaFor[node](); err == nil {
+		t.Error("expected error for recursive type")
+	}
+}
+
+func TestSchemaForRejectsEmbeddedRecursion(t *testing.T) {
+	if _, err := SchemaFor[schemaTestEmbedded](); err == nil {
+		t.Error("expected error for recursive embedded type")
+	}
+}
+
+func TestValidateResult(t *testing.T) {
+	schema, _ := SchemaFor[schemaTestResult]()
+
+	tests := []struct {
+		name     string
+		result   string
+		problems int
+	}{
+		{"valid", `{"correct":true,"score":90,"tags":["a"],"items":[{"name":"x"}]}`, 0},
+		{"fenced", "```json\n{\"correct\":true,\"score\":90}\n```", 0},
+		{"missing required", `{"correct":true}`, 1},
+		{"out of range", `{"correct":true,"score":150}`, 1},
+		{"wrong type", `{"correct":"yes","score":1.5}`, 2},
+		{"bad enum", `{"correct":true,"score":1,"level":"medium"}`, 1},
+		{"extra property", `{"correct":true,"score":1,"extra":1}`, 1},
+		{"nested", `{"correct":true,"score":1,"items":[{}]}`, 1},
+		{"not json", `Sure! Here is the result.`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResult(tt.result, schema)
+			if tt.problems == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if len(verr.Problems) != tt.problems {
+				t.Errorf("problems = %q, want %d", verr.Problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestAskInto(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"session_id":"s1","result":"{\"correct\":true,\"score\":80}"}'`)
+	c := NewClient(WithCLIPath(cli))
+
+	v, resp, err := AskInto[schemaTestResult](context.Background(), c, "grade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Correct || v.Score != 80 || resp.SessionID != "s1" {
+		t.Errorf("v = %+v, resp = %+v", v, resp)
+	}
+}
+
+func TestAskIntoValidationError(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"session_id":"s1","result":"{\"correct\":true,\"score\":\"high\"}"}'`)
+	c := NewClient(WithCLIPath(cli))
+
+	_, resp, err := AskInto[schemaTestResult](context.Background(), c, "grade")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if resp == nil || resp.SessionID != "s1" {
+		t.Errorf("expected Response alongside validation error, got %+v", resp)
+	}
+}
+
+func TestAskWithSchemaRepair(t *testing.T) {
+	cli := writeFakeCLI(t, `case "$*" in
+*--resume*) echo '{"session_id":"s2","result":"{\"correct\":true,\"score\":80}","total_cost_usd":0.25,"usage":{"input_tokens":5,"output_tokens":2}}' ;;
+*) echo '{"session_id":"s1","result":"{\"correct\":true,\"score\":180}","total_cost_usd":0.5,"usage":{"input_tokens":10,"output_tokens":4}}' ;;
+esac`)
+	schema, _ := SchemaFor[schemaTestResult]()
+
+	c := NewClient(WithCLIPath(cli), WithSchemaRepair(2))
+	resp, err := c.AskWithSchema(context.Background(), "grade", schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SessionID != "s2" || resp.Attempts != 2 {
+		t.Errorf("session = %q, attempts = %d", resp.SessionID, resp.Attempts)
+	}
+	if resp.TotalUsage != (Usage{InputTokens: 15, OutputTokens: 6}) {
+		t.Errorf("total usage = %+v", resp.TotalUsage)
+	}
+	if resp.TotalCostUSD != 0.25 || resp.TotalCostAllAttemptsUSD != 0.75 {
+		t.Errorf("cost = %v, all attempts = %v", resp.TotalCostUSD, resp.TotalCostAllAttemptsUSD)
+	}
+
+	c = NewClient(WithCLIPath(cli))
+	resp, err = c.AskWithSchema(context.Background(), "grade", schema)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError without repair, got %v", err)
+	}
+	if resp == nil || resp.Attempts != 1 {
+		t.Errorf("resp = %+v", resp)
+	}
+}
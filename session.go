@@ -0,0 +1,446 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSessionClosed is returned by Session methods once the session has been
+// closed or its process has exited.
+var ErrSessionClosed = errors.New("claude: session closed")
+
+// interruptTimeout is how long a stopped turn waits for its result after
+// the interrupt before giving up on it.
+var interruptTimeout = 10 * time.Second
+
+// Session is a long-running CLI process driven over stream-json input and
+// output. Each Send is one turn in the same process, so turns after the first
+// have no start-up cost, and a running turn can be interrupted.
+type Session struct {
+	log     callLog
+	budgets []*BudgetTracker
+	budget  StreamBudget
+	cleanup func()
+	cancel  context.CancelFunc
+	stdin   *os.File
+
+	// lines carries the process output to the running turn; tools carries
+	// Go tool events. Both are closed or abandoned when the process exits.
+	lines   chan StreamEvent
+	tools   chan StreamEvent
+	closing chan struct{}
+	exited  chan struct{}
+	exitErr error
+
+	// turnMu serializes turns and guards abandoned, the number of turns
+	// given up on before their result arrived; writeMu serializes writes to
+	// stdin; mu guards the fields below.
+	turnMu    sync.Mutex
+	abandoned int
+	writeMu   sync.Mutex
+	mu        sync.Mutex
+
+	// turnDone is closed when the running or last turn has returned.
+	turnDone   chan struct{}
+	closed     bool
+	sessionID  string
+	model      string
+	mcpServers []MCPServerStatus
+	requests   int
+	pending    map[string]chan controlResponse
+}
+
+// controlResponse is the CLI's answer to a control request.
+type controlResponse struct {
+	Subtype   string `json:"subtype"`
+	RequestID string `json:"request_id"`
+	Error     string `json:"error,omitempty"`
+}
+
+// OpenSession starts the CLI with stream-json input and output and keeps it
+// running until Close is called or ctx is done. The client's options apply to
+// the whole session; per-call options are applied once, when it is opened.
+// Retries are not performed.
+//
+// With WithMaxConcurrency, the session holds one of the client's slots until
+// its process exits, and opening it waits in the queue like a call does.
+func (c *Client) OpenSession(ctx context.Context, opts ...CallOption) (*Session, error) {
+	c = c.forCall(opts)
+	if _, err := c.limiter.acquire(ctx, c.maxQueue); err != nil {
+		return nil, err
+	}
+	s, err := c.openSession(ctx, c.limiter.release)
+	if err != nil {
+		c.limiter.release()
+	}
+	return s, err
+}
+
+// openSession starts the process of a session. release, if not nil, is
+// called once the process has exited.
+func (c *Client) openSession(ctx context.Context, release func()) (*Session, error) {
+	args := c.sessionArgs()
+
+	s := &Session{
+		lines:   make(chan StreamEvent),
+		tools:   make(chan StreamEvent),
+		closing: make(chan struct{}),
+		exited:  make(chan struct{}),
+		pending: map[string]chan controlResponse{},
+		budgets: c.budgets,
+		budget:  c.streamBudget,
+	}
+	args, cleanup, err := c.prepare(ctx, args, s.tools, &s.log)
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, w, err := os.Pipe()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("claude: open session: %w", err)
+	}
+	s.stdin = w
+	s.cleanup = cleanup
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := c.command(args)
+	cmd.Stdin = stdin
+	cmd.Stdout = pw
+	cmd.Stderr = &stderr
+
+	go func() {
+		err := c.runner.Run(runCtx, cmd)
+		// Writes to stdin fail from now on instead of filling the pipe.
+		stdin.Close()
+		pw.Close()
+		if err != nil {
+			s.exitErr = c.runError(runCtx, err, stderr.String(), "")
+		}
+		if release != nil {
+			release()
+		}
+		close(s.exited)
+	}()
+	go s.read(pr)
+	return s, nil
+}
+
+// sessionArgs returns the CLI arguments of a session.
+func (c *Client) sessionArgs() []string {
+	// Prompts are sent on stdin, so there is no prompt argument after -p.
+	args := c.buildArgs("", FormatStreamJSON, "--input-format", "stream-json")
+	return slices.Delete(args, 1, 2)
+}
+
+// SessionID returns the session ID reported by the CLI, or "" before the
+// first turn has started.
+func (s *Session) SessionID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionID
+}
+
+// Send sends prompt as the next user message and returns a Stream of the
+// turn's events. The stream ends with the turn's result event. The next turn
+// waits until this stream has finished. Cancelling ctx interrupts the turn;
+// if the CLI does not end it within 10 seconds, the stream fails with ctx's
+// error and the turn's result is skipped when it comes.
+func (s *Session) Send(ctx context.Context, prompt string) *Stream {
+	s.turnMu.Lock()
+	st := &Stream{
+		events: make(chan StreamEvent),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(st.done)
+		defer close(st.events)
+		defer s.turnMu.Unlock()
+		st.resp, st.err = s.turn(ctx, prompt, st.events)
+	}()
+	return st
+}
+
+// turn runs one turn and forwards its events.
+func (s *Session) turn(ctx context.Context, prompt string, events chan<- StreamEvent) (*Response, error) {
+	for _, b := range s.budgets {
+		if _, err := b.admit(); err != nil {
+			return nil, err
+		}
+	}
+	msg := map[string]any{
+		"type":    "user",
+		"message": map[string]any{"role": "user", "content": prompt},
+	}
+	turnDone := make(chan struct{})
+	defer close(turnDone)
+	s.mu.Lock()
+	s.turnDone = turnDone
+	s.mu.Unlock()
+	if err := s.write(msg); err != nil {
+		return nil, err
+	}
+
+	watch := newBudgetWatch(s.budget)
+	var stopped error
+	var timeout <-chan time.Time
+	done := ctx.Done()
+	// stop interrupts the turn and discards the rest of its events, so the
+	// next turn starts cleanly.
+	stop := func() {
+		done = nil
+		events = nil
+		timeout = time.After(interruptTimeout)
+		go s.Interrupt(context.WithoutCancel(ctx))
+	}
+	for {
+		var ev StreamEvent
+		var ok bool
+		select {
+		case ev, ok = <-s.lines:
+			if !ok {
+				return nil, s.exitError()
+			}
+			if s.abandoned > 0 {
+				// Output of a turn given up on: the CLI answers messages in
+				// order, so it all comes before this turn's output.
+				if ev.Type == "result" {
+					s.abandoned--
+				}
+				continue
+			}
+		case ev = <-s.tools:
+		case <-done:
+			stop()
+			continue
+		case <-timeout:
+			// The CLI did not end the turn after the interrupt; skip its
+			// result if it comes later.
+			s.abandoned++
+			if stopped != nil {
+				return nil, stopped
+			}
+			return nil, newError(ctx, ctx.Err(), "", "")
+		}
+
+		if ev.Type == "result" {
+			var resp Response
+			if err := json.Unmarshal(ev.Raw, &resp); err != nil {
+				return nil, fmt.Errorf("claude: parse result event: %w", err)
+			}
+			s.mu.Lock()
+			if resp.Model == "" {
+				resp.Model = s.model
+			}
+			resp.MCPServers = s.mcpServers
+			s.mu.Unlock()
+			s.log.take(&resp)
+			for _, b := range s.budgets {
+				b.Add(&resp)
+			}
+			if stopped != nil {
+				return &resp, stopped
+			}
+			if events == nil {
+				return &resp, newError(ctx, ctx.Err(), "", "")
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return &resp, newError(ctx, ctx.Err(), "", "")
+			}
+			return &resp, resultError(&resp)
+		}
+
+		if events != nil {
+			select {
+			case events <- ev:
+			case <-done:
+				stop()
+				continue
+			}
+			if err := watch.observe(ev); err != nil {
+				// The stream budget has been crossed: stop the turn like a
+				// cancellation, but report the budget error.
+				stopped = err
+				stop()
+			}
+		}
+	}
+}
+
+// Interrupt asks the CLI to stop the running turn, which then ends with a
+// result event. It returns once the CLI has acknowledged the request.
+func (s *Session) Interrupt(ctx context.Context) error {
+	s.mu.Lock()
+	s.requests++
+	id := "req_" + strconv.Itoa(s.requests)
+	reply := make(chan controlResponse, 1)
+	s.pending[id] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	req := map[string]any{
+		"type":       "control_request",
+		"request_id": id,
+		"request":    map[string]any{"subtype": "interrupt"},
+	}
+	if err := s.write(req); err != nil {
+		return err
+	}
+	select {
+	case resp := <-reply:
+		if resp.Subtype == "error" {
+			return fmt.Errorf("claude: interrupt: %s", resp.Error)
+		}
+		return nil
+	case <-s.exited:
+		return s.exitError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close ends the session: stdin is closed, so the CLI finishes the running
+// turn, if any, and exits. Close waits for the process to exit and removes
+// the resources of the session. Cancel the context passed to OpenSession to
+// stop the process immediately instead.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.exited
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.writeMu.Lock()
+	s.stdin.Close()
+	s.writeMu.Unlock()
+	close(s.closing)
+
+	<-s.exited
+	s.cancel()
+	s.cleanup()
+	return s.exitErr
+}
+
+// alive reports whether the process is still running.
+func (s *Session) alive() bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// write sends a stream-json message to the CLI.
+func (s *Session) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("claude: encode message: %w", err)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrSessionClosed
+	}
+	if _, err := s.stdin.Write(append(data, '\n')); err != nil {
+		return s.exitError()
+	}
+	return nil
+}
+
+// exitError waits for the process to exit and returns why the session ended.
+func (s *Session) exitError() error {
+	<-s.exited
+	if s.exitErr != nil {
+		return s.exitErr
+	}
+	return ErrSessionClosed
+}
+
+// read parses the process output, answers control responses and hands the
+// other events to the running turn. After Close, events the running turn does
+// not take before it returns are dropped so the process can exit.
+func (s *Session) read(r io.Reader) {
+	defer close(s.lines)
+	// Keep draining after an error so the process is not blocked on output.
+	defer io.Copy(io.Discard, r)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var ev StreamEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		ev.Raw = append(json.RawMessage(nil), line...)
+
+		switch ev.Type {
+		case "control_response":
+			var msg struct {
+				Response controlResponse `json:"response"`
+			}
+			json.Unmarshal(line, &msg)
+			s.mu.Lock()
+			if reply := s.pending[msg.Response.RequestID]; reply != nil {
+				reply <- msg.Response
+			}
+			s.mu.Unlock()
+			continue
+		case "system":
+			if ev.Subtype == "init" {
+				var initEv SystemInitEvent
+				if err := json.Unmarshal(line, &initEv); err == nil {
+					s.mu.Lock()
+					s.sessionID = initEv.SessionID
+					s.model = initEv.Model
+					s.mcpServers = initEv.MCPServers
+					s.mu.Unlock()
+				}
+			}
+		}
+
+		select {
+		case s.lines <- ev:
+		case <-s.closing:
+			s.mu.Lock()
+			turnDone := s.turnDone
+			s.mu.Unlock()
+			if turnDone != nil {
+				select {
+				case s.lines <- ev:
+				case <-turnDone:
+				}
+			}
+		}
+	}
+}
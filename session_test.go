@@ -0,0 +1,383 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sessionCLI is a fake CLI speaking stream-json on stdin and stdout. It
+// answers each user message with an assistant event and a result; the prompt
+// "slow" uses 1M input tokens and waits for an interrupt before its result.
+func sessionCLI(t *testing.T, starts *atomic.Int32) Runner {
+	return RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		starts.Add(1)
+		if i := slices.Index(cmd.Args, "--input-format"); i < 0 || cmd.Args[i+1] != "stream-json" {
+			t.Errorf("args = %q", cmd.Args)
+		}
+		if cmd.Args[0] != "-p" || cmd.Args[1] != "--output-format" {
+			t.Errorf("args = %q, want -p without a prompt", cmd.Args)
+		}
+
+		out := json.NewEncoder(cmd.Stdout)
+		turns := 0
+		result := func(subtype, text string) {
+			turns++
+			out.Encode(map[string]any{"type": "result", "subtype": subtype, "result": text,
+				"session_id": "s1", "num_turns": turns, "usage": map[string]int{"output_tokens": 3}})
+		}
+		waiting := false
+
+		scanner := bufio.NewScanner(cmd.Stdin)
+		for scanner.Scan() {
+			var msg struct {
+				Type      string `json:"type"`
+				RequestID string `json:"request_id"`
+				Request   struct {
+					Subtype string `json:"subtype"`
+				} `json:"request"`
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Errorf("bad input line %q: %v", scanner.Text(), err)
+				continue
+			}
+			switch msg.Type {
+			case "user":
+				out.Encode(map[string]any{"type": "system", "subtype": "init", "session_id": "s1", "model": "sonnet"})
+				message := map[string]any{"content": []map[string]string{{"type": "text", "text": "echo: " + msg.Message.Content}}}
+				if msg.Message.Content == "slow" {
+					message["id"] = "msg_slow"
+					message["usage"] = map[string]int{"input_tokens": 1_000_000}
+				}
+				out.Encode(map[string]any{"type": "assistant", "session_id": "s1", "message": message})
+				if msg.Message.Content == "slow" {
+					waiting = true
+					continue
+				}
+				result("success", "echo: "+msg.Message.Content)
+			case "control_request":
+				if msg.Request.Subtype != "interrupt" {
+					t.Errorf("control request = %q", msg.Request.Subtype)
+				}
+				out.Encode(map[string]any{"type": "control_response",
+					"response": map[string]any{"subtype": "success", "request_id": msg.RequestID}})
+				if waiting {
+					waiting = false
+					result("error_during_execution", "")
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func TestSessionTurns(t *testing.T) {
+	var starts atomic.Int32
+	c := NewClient(WithRunner(sessionCLI(t, &starts)), WithModel("sonnet"))
+	s, err := c.OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, prompt := range []string{"one", "two", "three"} {
+		st := s.Send(context.Background(), prompt)
+		var text string
+		for ev := range st.Events() {
+			if ev.Type == "assistant" {
+				text = ev.Raw.String()
+			}
+		}
+		resp, err := st.Result()
+		if err != nil {
+			t.Fatalf("turn %d: %v", i, err)
+		}
+		if resp.Result != "echo: "+prompt || !strings.Contains(text, "echo: "+prompt) || resp.Model != "sonnet" {
+			t.Errorf("turn %d: resp = %+v, assistant = %s", i, resp, text)
+		}
+	}
+	if s.SessionID() != "s1" {
+		t.Errorf("SessionID = %q", s.SessionID())
+	}
+	if n := starts.Load(); n != 1 {
+		t.Errorf("CLI started %d times, want 1", n)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := s.Send(context.Background(), "after").Result(); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Send after Close: err = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestSessionHoldsConcurrencySlot(t *testing.T) {
+	var starts atomic.Int32
+	c := NewClient(WithRunner(sessionCLI(t, &starts)), WithMaxConcurrency(1), WithMaxQueue(0))
+	s, err := c.OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := c.QueueStats(); st.Running != 1 {
+		t.Errorf("stats with open session = %+v", st)
+	}
+	if _, err := c.OpenSession(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("second OpenSession: err = %v, want ErrQueueFull", err)
+	}
+
+	s.Close()
+	if st := c.QueueStats(); st.Running != 0 {
+		t.Errorf("stats after Close = %+v", st)
+	}
+	s, err = c.OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
+
+func TestSessionInterrupt(t *testing.T) {
+	var starts atomic.Int32
+	s, err := NewClient(WithRunner(sessionCLI(t, &starts))).OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	st := s.Send(context.Background(), "slow")
+	for ev := range st.Events() {
+		if ev.Type == "assistant" {
+			if err := s.Interrupt(context.Background()); err != nil {
+				t.Fatalf("Interrupt: %v", err)
+			}
+		}
+	}
+	resp, err := st.Result()
+	if err != nil || resp.Result != "" {
+		t.Fatalf("interrupted turn: resp = %+v, err = %v", resp, err)
+	}
+
+	// Cancelling a turn's context interrupts it; the session stays usable.
+	ctx, cancel := context.WithCancel(context.Background())
+	st = s.Send(ctx, "slow")
+	<-st.Events()
+	cancel()
+	if _, err := st.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled turn: err = %v", err)
+	}
+
+	resp, err = s.Send(context.Background(), "next").Result()
+	if err != nil || resp.Result != "echo: next" {
+		t.Errorf("turn after cancel: resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestSessionStreamBudget(t *testing.T) {
+	var starts atomic.Int32
+	c := NewClient(WithRunner(sessionCLI(t, &starts)), WithModel("sonnet"), WithStreamBudget(StreamBudget{HardUSD: 1}))
+	s, err := c.OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// The slow turn costs $15 at the default price for unknown models and is
+	// interrupted.
+	resp, err := s.Send(context.Background(), "slow").Result()
+	var berr *BudgetExceededError
+	if !errors.As(err, &berr) || berr.Output != "echo: slow" || resp == nil || resp.SessionID != "s1" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if resp, err := s.Send(context.Background(), "next").Result(); err != nil || resp.Result != "echo: next" {
+		t.Errorf("turn after budget stop: resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestSessionProcessExit(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stderr, "Error: Invalid API key")
+		return &ExitError{Code: 1}
+	})
+	s, err := NewClient(WithRunner(r)).OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Send(context.Background(), "hi").Result()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrAuth) {
+			t.Errorf("err = %v, want ErrAuth", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not return after the process exited")
+	}
+	if err := s.Close(); !errors.Is(err, ErrAuth) {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestSessionCloseDuringLastEvent(t *testing.T) {
+	// The CLI writes one more event after each result and one on exit.
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		out := json.NewEncoder(cmd.Stdout)
+		scanner := bufio.NewScanner(cmd.Stdin)
+		for scanner.Scan() {
+			out.Encode(map[string]any{"type": "assistant", "message": map[string]any{"content": []any{}}})
+			out.Encode(map[string]any{"type": "result", "subtype": "success", "result": "ok"})
+			out.Encode(map[string]any{"type": "system", "subtype": "status"})
+		}
+		out.Encode(map[string]any{"type": "system", "subtype": "status"})
+		return nil
+	})
+	s, err := NewClient(WithRunner(r)).OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close while the turn is handing over its result and the trailing
+	// event is waiting to be read.
+	st := s.Send(context.Background(), "hi")
+	<-st.Events()
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+	time.Sleep(50 * time.Millisecond)
+	for range st.Events() {
+	}
+	if resp, err := st.Result(); err != nil || resp.Result != "ok" {
+		t.Errorf("resp = %+v, err = %v", resp, err)
+	}
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestSessionInterruptIgnored(t *testing.T) {
+	defer func(d time.Duration) { interruptTimeout = d }(interruptTimeout)
+	interruptTimeout = 50 * time.Millisecond
+
+	// The CLI acknowledges the interrupt of the "stuck" turn but only ends it
+	// when the next message arrives.
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		out := json.NewEncoder(cmd.Stdout)
+		stuck := false
+		scanner := bufio.NewScanner(cmd.Stdin)
+		for scanner.Scan() {
+			var msg struct {
+				Type      string `json:"type"`
+				RequestID string `json:"request_id"`
+				Message   struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			}
+			json.Unmarshal(scanner.Bytes(), &msg)
+			if msg.Type == "control_request" {
+				out.Encode(map[string]any{"type": "control_response",
+					"response": map[string]any{"subtype": "success", "request_id": msg.RequestID}})
+				continue
+			}
+			if stuck {
+				stuck = false
+				out.Encode(map[string]any{"type": "result", "subtype": "success", "result": "late"})
+			}
+			out.Encode(map[string]any{"type": "assistant", "message": map[string]any{"content": []any{}}})
+			if msg.Message.Content == "stuck" {
+				stuck = true
+				continue
+			}
+			out.Encode(map[string]any{"type": "result", "subtype": "success", "result": "echo: " + msg.Message.Content})
+		}
+		return nil
+	})
+	s, err := NewClient(WithRunner(r)).OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st := s.Send(ctx, "stuck")
+	<-st.Events()
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := st.Result()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("stuck turn: err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck turn did not return after the interrupt")
+	}
+
+	// The late result of the stuck turn is not taken for the next one.
+	if resp, err := s.Send(context.Background(), "next").Result(); err != nil || resp.Result != "echo: next" {
+		t.Errorf("turn after stuck turn: resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestSessionCancelOpenContext(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		<-ctx.Done()
+		return fmt.Errorf("signal: killed")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewClient(WithRunner(r)).OpenSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := s.Close(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestSessionExecRunner(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "claude")
+	body := "#!/bin/sh\nwhile read -r line; do echo '{\"type\":\"result\",\"result\":\"ok\",\"session_id\":\"s1\"}'; done\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewClient(WithCLIPath(script)).OpenSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		resp, err := s.Send(context.Background(), "hi").Result()
+		if err != nil || resp.Result != "ok" {
+			t.Fatalf("resp = %+v, err = %v", resp, err)
+		}
+	}
+	// The script exits when stdin is closed.
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
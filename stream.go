@@ -5,74 +5,294 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"time"
 )
 
+// maxStreamLineSize bounds a single stream-json line. Assistant and tool
+// result events carry whole messages and can be far larger than the
+// bufio.Scanner default.
+const maxStreamLineSize = 16 * 1024 * 1024
+
+// ErrNoResult is returned by Stream.Result when the stream ended without the
+// CLI emitting its terminal result event.
+var ErrNoResult = errors.New("claude: stream ended without a result event")
+
+// Stream is a streaming run started by Client.Stream. Receive events from
+// Events, then call Result to obtain the final Response.
+type Stream struct {
+	events chan StreamEvent
+	done   chan struct{}
+
+	resp *Response
+	err  error
+}
+
+// Events returns the channel of stream events. It is closed when the stream ends.
+func (s *Stream) Events() <-chan StreamEvent {
+	return s.events
+}
+
+// Result waits for the stream to end and returns the Response built from the
+// CLI's terminal result event. Events that have not been received yet are
+// discarded, so Result may be called without reading Events at all.
+func (s *Stream) Result() (*Response, error) {
+	for range s.events {
+	}
+	<-s.done
+	if s.err == nil && s.resp == nil {
+		return nil, ErrNoResult
+	}
+	return s.resp, s.err
+}
+
+// Stream runs the prompt with stream-json output. Unlike AskStream, the
+// returned Stream also exposes the final Response (session ID, usage, cost),
+// so a streamed turn can be continued with Resume.
+// Cancelling the context will kill the underlying process.
+func (c *Client) Stream(ctx context.Context, prompt string, opts ...CallOption) *Stream {
+	c = c.forCall(opts)
+	if s := c.pooledStream(ctx, prompt); s != nil {
+		return s
+	}
+	return c.startStream(ctx, c.buildArgs(prompt, FormatStreamJSON), nil, nil)
+}
+
+// ResumeStream is the streaming counterpart of Resume.
+func (c *Client) ResumeStream(ctx context.Context, sessionID string, prompt string, opts ...CallOption) *Stream {
+	c = c.forCall(opts)
+	return c.startStream(ctx, c.buildArgs(prompt, FormatStreamJSON, "--resume", sessionID), nil, nil)
+}
+
+// ContinueStream is the streaming counterpart of Continue.
+func (c *Client) ContinueStream(ctx context.Context, prompt string, opts ...CallOption) *Stream {
+	c = c.forCall(opts)
+	return c.startStream(ctx, c.buildArgs(prompt, FormatStreamJSON, "--continue"), nil, nil)
+}
+
+// PipeStream is the streaming counterpart of Pipe: input is sent as stdin
+// alongside the prompt.
+func (c *Client) PipeStream(ctx context.Context, input io.Reader, prompt string, opts ...CallOption) *Stream {
+	c = c.forCall(opts)
+	return c.startStream(ctx, c.buildArgs(prompt, FormatStreamJSON), input, nil)
+}
+
+// AskWithSchemaStream is the streaming counterpart of AskWithSchema. The final
+// result is validated against schema; Result returns a *ValidationError
+// together with the Response if it does not match. Schema repair is not
+// performed for streams.
+func (c *Client) AskWithSchemaStream(ctx context.Context, prompt string, schema string, opts ...CallOption) *Stream {
+	c = c.forCall(opts)
+	args := c.buildArgs(prompt, FormatStreamJSON, "--output-schema", schema)
+	return c.startStream(ctx, args, nil, func(resp *Response, err error) (*Response, error) {
+		if err != nil || resp == nil {
+			return resp, err
+		}
+		resp.Attempts = 1
+		resp.TotalUsage = resp.Usage
+		resp.TotalCostAllAttemptsUSD = resp.TotalCostUSD
+		return resp, validateResult(resp.Result, schema)
+	})
+}
+
+// startStream runs the CLI with args in the background, feeding it stdin if
+// non-nil. If finish is non-nil, it is called with the outcome once the
+// process has exited and may replace it; it runs before Result returns.
+func (c *Client) startStream(ctx context.Context, args []string, stdin io.Reader, finish func(*Response, error) (*Response, error)) *Stream {
+	s := &Stream{
+		events: make(chan StreamEvent),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		defer close(s.events)
+		s.resp, s.err = c.runStream(ctx, args, stdin, s.events)
+		if finish != nil {
+			s.resp, s.err = finish(s.resp, s.err)
+		}
+	}()
+	return s
+}
+
 // AskStream runs the prompt with stream-json output and returns channels for
 // events and errors. The events channel is closed when the stream ends.
 // The error channel receives at most one error, then is closed.
 // Cancelling the context will kill the underlying process.
-func (c *Client) AskStream(ctx context.Context, prompt string) (<-chan StreamEvent, <-chan error) {
-	events := make(chan StreamEvent)
+func (c *Client) AskStream(ctx context.Context, prompt string, opts ...CallOption) (<-chan StreamEvent, <-chan error) {
+	s := c.Stream(ctx, prompt, opts...)
 	errc := make(chan error, 1)
 
 	go func() {
-		defer close(events)
 		defer close(errc)
+		<-s.done
+		if s.err != nil {
+			errc <- s.err
+		}
+	}()
 
-		args := c.buildArgs(prompt, FormatStreamJSON)
-		cmd := c.newCmd(ctx, args)
+	return s.events, errc
+}
 
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			errc <- fmt.Errorf("claude: stdout pipe: %w", err)
-			return
-		}
+// runStream starts the CLI with args, sends each parsed event to events and
+// returns the Response built from the terminal result event, if any.
+// Failures are retried according to the retry policy only while no event has
+// been emitted yet. The call first waits for a slot under WithMaxConcurrency.
+func (c *Client) runStream(ctx context.Context, args []string, stdin io.Reader, events chan<- StreamEvent) (*Response, error) {
+	wait, err := c.limiter.acquire(ctx, c.maxQueue)
+	if err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+	return c.runStreamAcquired(ctx, args, stdin, events, wait)
+}
 
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
+// runStreamAcquired is runStream for a call that already holds its
+// concurrency slot, after waiting for it for wait.
+func (c *Client) runStreamAcquired(ctx context.Context, args []string, stdin io.Reader, events chan<- StreamEvent, wait time.Duration) (*Response, error) {
+	var log callLog
+	log.setQueueWait(wait)
+	args, cleanup, err := c.prepare(ctx, args, events, &log)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
 
-		if err := cmd.Start(); err != nil {
-			errc <- fmt.Errorf("claude: start: %w", err)
-			return
-		}
+	input, err := c.inputSource(stdin)
+	if err != nil {
+		return nil, err
+	}
 
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(line) == 0 {
-				continue
+	for attempt := 1; ; attempt++ {
+		emitted := false
+		resp, err := c.runStreamOnce(ctx, args, input(), events, &emitted)
+		if err == nil || emitted || !c.retryPolicy.retry(ctx, attempt, err) {
+			log.apply(resp)
+			if resp != nil {
+				c.chargeBudget(resp)
+			}
+			if err == nil {
+				err = resultError(resp)
 			}
+			return resp, err
+		}
+	}
+}
+
+// runStreamOnce performs a single streaming attempt. emitted is set once the
+// first event has been sent.
+func (c *Client) runStreamOnce(ctx context.Context, args []string, stdin io.Reader, events chan<- StreamEvent, emitted *bool) (*Response, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := c.command(args)
+	cmd.Stdin = stdin
+	cmd.Stdout = pw
+	cmd.Stderr = &stderr
+
+	runErr := make(chan error, 1)
+	go func() {
+		err := c.execute(runCtx, cmd)
+		pw.Close()
+		runErr <- err
+	}()
 
-			var ev StreamEvent
-			if err := json.Unmarshal(line, &ev); err != nil {
-				errc <- fmt.Errorf("claude: parse stream event: %w", err)
-				return
+	watch := newBudgetWatch(c.streamBudget)
+	resp, streamErr := readStream(ctx, pr, events, emitted, watch)
+	if streamErr != nil {
+		// Stop the process and unblock its writes before waiting for it.
+		cancel()
+		pr.CloseWithError(streamErr)
+		err := <-runErr
+		if ctx.Err() != nil {
+			// A *TerminatedError names the signal that stopped the process.
+			if errors.As(err, new(*TerminatedError)) {
+				streamErr = err
 			}
+			return nil, newError(ctx, streamErr, stderr.String(), "")
+		}
+		if berr, ok := streamErr.(*BudgetExceededError); ok {
+			return watch.response(berr), berr
+		}
+		return nil, streamErr
+	}
 
-			select {
-			case events <- ev:
-			case <-ctx.Done():
-				errc <- ctx.Err()
-				return
+	if err := <-runErr; err != nil {
+		e := c.runError(ctx, err, stderr.String(), "")
+		if resp != nil && resp.IsError {
+			// The result event explains the failure better than the exit code.
+			if kind := resp.errorKind(); kind != KindUnknown && e.Kind == KindUnknown {
+				e.Kind = kind
 			}
+			e.Result = resp
+			return resp, e
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// readStream scans stream-json lines from r and forwards them to events,
+// setting emitted once an event has been sent. The init event's model and
+// MCP server status are carried over to the Response because the result
+// event does not report them. Reading stops with a *BudgetExceededError when
+// watch reports that a stream budget has been crossed.
+func readStream(ctx context.Context, r io.Reader, events chan<- StreamEvent, emitted *bool, watch *budgetWatch) (*Response, error) {
+	var (
+		resp       *Response
+		model      string
+		mcpServers []MCPServerStatus
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
 		}
 
-		if err := scanner.Err(); err != nil {
-			errc <- fmt.Errorf("claude: read stream: %w", err)
-			return
+		var ev StreamEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return nil, fmt.Errorf("claude: parse stream event: %w", err)
 		}
+		ev.Raw = append(json.RawMessage(nil), line...)
 
-		if err := cmd.Wait(); err != nil {
-			msg := strings.TrimSpace(stderr.String())
-			if msg != "" {
-				errc <- fmt.Errorf("claude: %s", msg)
-			} else {
-				errc <- wrapExecError(err)
+		switch {
+		case ev.Type == "system" && ev.Subtype == "init":
+			var initEv SystemInitEvent
+			if err := json.Unmarshal(line, &initEv); err == nil {
+				model = initEv.Model
+				mcpServers = initEv.MCPServers
 			}
+		case ev.Type == "result":
+			var res Response
+			if err := json.Unmarshal(line, &res); err != nil {
+				return nil, fmt.Errorf("claude: parse result event: %w", err)
+			}
+			if res.Model == "" {
+				res.Model = model
+			}
+			res.MCPServers = mcpServers
+			resp = &res
 		}
-	}()
 
-	return events, errc
+		select {
+		case events <- ev:
+			*emitted = true
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if err := watch.observe(ev); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("claude: read stream: %w", err)
+	}
+	return resp, nil
 }
@@ -0,0 +1,115 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFakeCLI writes an executable shell script standing in for the claude
+// binary and returns its path.
+func writeFakeCLI(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStreamResult(t *testing.T) {
+	cli := writeFakeCLI(t, `cat <<'EOF2'
+{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet"}
+{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"4"}}}
+{"type":"result","subtype":"success","result":"4","session_id":"s1","usage":{"input_tokens":3,"output_tokens":1}}
+EOF2
+`)
+	c := NewClient(WithCLIPath(cli))
+	s := c.Stream(context.Background(), "2+2")
+
+	var types []string
+	for ev := range s.Events() {
+		types = append(types, ev.Type)
+	}
+	if len(types) != 3 {
+		t.Fatalf("events = %v", types)
+	}
+
+	resp, err := s.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SessionID != "s1" || resp.Result != "4" || resp.Usage.OutputTokens != 1 {
+		t.Errorf("resp = %+v", resp)
+	}
+	if resp.Model != "claude-sonnet" {
+		t.Errorf("model = %q, want model from init event", resp.Model)
+	}
+}
+
+func TestStreamNoResult(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'`)
+	c := NewClient(WithCLIPath(cli))
+
+	if _, err := c.Stream(context.Background(), "hi").Result(); !errors.Is(err, ErrNoResult) {
+		t.Errorf("err = %v, want ErrNoResult", err)
+	}
+}
+
+func TestAskStreamProcessError(t *testing.T) {
+	cli := writeFakeCLI(t, `echo "boom" >&2; exit 3`)
+	c := NewClient(WithCLIPath(cli))
+
+	events, errc := c.AskStream(context.Background(), "hi")
+	for range events {
+	}
+	if err := <-errc; err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStreamVariants(t *testing.T) {
+	// The fake CLI echoes its arguments and stdin back as the result.
+	cli := writeFakeCLI(t, `input=""
+[ -t 0 ] || input=$(cat)
+printf '{"type":"result","subtype":"success","result":"%s|%s","session_id":"s1"}\n' "$*" "$input"`)
+	c := NewClient(WithCLIPath(cli))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		s    *Stream
+		want string
+	}{
+		{"resume", c.ResumeStream(ctx, "abc", "more"), "--resume abc|"},
+		{"continue", c.ContinueStream(ctx, "more"), "--continue|"},
+		{"pipe", c.PipeStream(ctx, strings.NewReader("log data"), "summarize"), "|log data"},
+	}
+	for _, tt := range tests {
+		resp, err := tt.s.Result()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !strings.Contains(resp.Result, "--output-format stream-json") || !strings.HasSuffix(resp.Result, tt.want) {
+			t.Errorf("%s: result = %q, want suffix %q", tt.name, resp.Result, tt.want)
+		}
+	}
+}
+
+func TestAskWithSchemaStreamValidation(t *testing.T) {
+	cli := writeFakeCLI(t, `echo '{"type":"result","subtype":"success","result":"{\"name\":1}","session_id":"s1"}'`)
+	c := NewClient(WithCLIPath(cli))
+	schema := `{"type":"object","properties":{"name":{"type":"string"}}}`
+
+	resp, err := c.AskWithSchemaStream(context.Background(), "person", schema).Result()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if resp == nil || resp.SessionID != "s1" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
@@ -0,0 +1,260 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StreamBudget limits the cost of a streaming run while it is running. The
+// cost is estimated from the usage reported with each assistant message and
+// a local pricing table, so a run is stopped before the CLI's own
+// --max-budget-usd check, which only happens between turns.
+type StreamBudget struct {
+	// SoftUSD stops the run once the turn in progress has finished: when the
+	// estimate crosses it, the run ends before the next model request.
+	SoftUSD float64
+	// HardUSD stops the run as soon as the estimate crosses it.
+	HardUSD float64
+	// Pricing prices the models of the run; nil means DefaultPricing.
+	Pricing Pricing
+}
+
+// WithStreamBudget enforces b on Stream, AskStream and the other streaming
+// calls, including Conversation.SendStream and Session turns. Zero limits are
+// not enforced. A run that crosses a limit ends with a *BudgetExceededError,
+// and the Response returned with it holds the partial output and estimated
+// usage. Calls do not use a Pool while a stream budget is set.
+func WithStreamBudget(b StreamBudget) Option {
+	return func(c *Client) {
+		c.streamBudget = b
+	}
+}
+
+// CallStreamBudget overrides the stream budget for one call.
+func CallStreamBudget(b StreamBudget) CallOption {
+	return CallOption(WithStreamBudget(b))
+}
+
+// BudgetExceededError is returned when a streaming run is stopped by a
+// StreamBudget. It matches ErrBudgetExceeded.
+type BudgetExceededError struct {
+	// Limit is the limit that was crossed and Hard reports whether it was
+	// StreamBudget.HardUSD.
+	Limit float64
+	Hard  bool
+	// CostUSD and Usage are the estimated cost and the usage of the run up
+	// to the point where it was stopped.
+	CostUSD float64
+	Usage   Usage
+	// Output is the assistant text produced so far.
+	Output    string
+	SessionID string
+}
+
+func (e *BudgetExceededError) Error() string {
+	kind := "soft"
+	if e.Hard {
+		kind = "hard"
+	}
+	return fmt.Sprintf("claude: stream budget exceeded (estimated $%.4f, %s limit $%.4f)", e.CostUSD, kind, e.Limit)
+}
+
+// Is reports whether target is ErrBudgetExceeded.
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// enabled reports whether b limits anything.
+func (b StreamBudget) enabled() bool {
+	return b.SoftUSD > 0 || b.HardUSD > 0
+}
+
+// budgetWatch follows the events of one run and estimates its cost.
+type budgetWatch struct {
+	budget  StreamBudget
+	pricing Pricing
+
+	model     string
+	sessionID string
+	messages  map[string]*watchedMessage
+	order     []string
+	current   string
+	// soft is set once the soft limit has been crossed.
+	soft *BudgetExceededError
+}
+
+// watchedMessage is one model request of a run.
+type watchedMessage struct {
+	model string
+	usage Usage
+	// text collects the text blocks of the message's assistant events and
+	// deltas its streamed text, which is used until the blocks arrive.
+	text   strings.Builder
+	deltas strings.Builder
+	// sub is set for messages of subagents, whose text is not output.
+	sub bool
+}
+
+// newBudgetWatch returns a watch for b, or nil if b is not enabled.
+func newBudgetWatch(b StreamBudget) *budgetWatch {
+	if !b.enabled() {
+		return nil
+	}
+	pricing := b.Pricing
+	if pricing == nil {
+		pricing = DefaultPricing()
+	}
+	return &budgetWatch{budget: b, pricing: pricing, messages: map[string]*watchedMessage{}}
+}
+
+// observe records ev and returns a *BudgetExceededError when the run must
+// stop after it.
+func (w *budgetWatch) observe(ev StreamEvent) error {
+	if w == nil {
+		return nil
+	}
+	var line struct {
+		SessionID       string `json:"session_id"`
+		ParentToolUseID string `json:"parent_tool_use_id"`
+	}
+	json.Unmarshal(ev.Raw, &line)
+	if line.SessionID != "" {
+		w.sessionID = line.SessionID
+	}
+
+	// Tool results are sent with the next model request, which the soft
+	// limit does not allow.
+	if w.soft != nil && ev.Type == "user" {
+		return w.soft
+	}
+
+	typed, err := ev.Decode()
+	if err != nil {
+		return nil
+	}
+	switch e := typed.(type) {
+	case *SystemInitEvent:
+		w.model = e.Model
+	case *MessageStartEvent:
+		if w.soft != nil {
+			return w.soft
+		}
+		m := w.message(e.Message.ID, e.Message.Model, line.ParentToolUseID != "")
+		m.usage = maxUsage(m.usage, e.Message.Usage)
+		w.current = e.Message.ID
+	case *ContentBlockDeltaEvent:
+		if m := w.messages[w.current]; m != nil && e.Delta.Type == "text_delta" {
+			m.deltas.WriteString(e.Delta.Text)
+		}
+	case *MessageDeltaEvent:
+		if m := w.messages[w.current]; m != nil {
+			m.usage = maxUsage(m.usage, e.Usage)
+		}
+	case *AssistantEvent:
+		m := w.message(e.Message.ID, e.Message.Model, e.ParentToolUseID != "")
+		m.usage = maxUsage(m.usage, e.Message.Usage)
+		for _, block := range e.Message.Content {
+			if block.Type == "text" {
+				m.text.WriteString(block.Text)
+			}
+		}
+	default:
+		return nil
+	}
+	return w.check()
+}
+
+// message returns the record of message id, creating it if needed.
+func (w *budgetWatch) message(id, model string, sub bool) *watchedMessage {
+	m, ok := w.messages[id]
+	if !ok {
+		m = &watchedMessage{model: model, sub: sub}
+		w.messages[id] = m
+		w.order = append(w.order, id)
+	}
+	if m.model == "" {
+		m.model = model
+	}
+	return m
+}
+
+// check compares the estimate with the limits.
+func (w *budgetWatch) check() error {
+	cost, _ := w.estimate()
+	switch {
+	case w.budget.HardUSD > 0 && cost >= w.budget.HardUSD:
+		return w.exceeded(w.budget.HardUSD, true)
+	case w.soft == nil && w.budget.SoftUSD > 0 && cost >= w.budget.SoftUSD:
+		w.soft = w.exceeded(w.budget.SoftUSD, false)
+	case w.soft != nil:
+		// Keep the usage of the turn that is allowed to finish up to date.
+		limit := w.soft.Limit
+		*w.soft = *w.exceeded(limit, false)
+	}
+	return nil
+}
+
+// estimate returns the estimated cost and the usage of the run so far.
+func (w *budgetWatch) estimate() (float64, Usage) {
+	var (
+		cost  float64
+		usage Usage
+	)
+	for _, id := range w.order {
+		m := w.messages[id]
+		model := m.model
+		if model == "" {
+			model = w.model
+		}
+		cost += w.pricing.Cost(model, m.usage)
+		usage = usage.Add(m.usage)
+	}
+	return cost, usage
+}
+
+func (w *budgetWatch) exceeded(limit float64, hard bool) *BudgetExceededError {
+	cost, usage := w.estimate()
+	var out strings.Builder
+	for _, id := range w.order {
+		switch m := w.messages[id]; {
+		case m.sub:
+		case m.text.Len() > 0:
+			out.WriteString(m.text.String())
+		default:
+			out.WriteString(m.deltas.String())
+		}
+	}
+	return &BudgetExceededError{
+		Limit:     limit,
+		Hard:      hard,
+		CostUSD:   cost,
+		Usage:     usage,
+		Output:    out.String(),
+		SessionID: w.sessionID,
+	}
+}
+
+// response returns the partial Response of a run stopped with e.
+func (w *budgetWatch) response(e *BudgetExceededError) *Response {
+	return &Response{
+		Subtype:      ResultErrorMaxBudget,
+		IsError:      true,
+		SessionID:    e.SessionID,
+		Result:       e.Output,
+		Model:        w.model,
+		TotalCostUSD: e.CostUSD,
+		Usage:        e.Usage,
+	}
+}
+
+// maxUsage returns the larger of each counter of a and b. Usage reported for
+// a message grows while it is streamed and repeats with every content block.
+func maxUsage(a, b Usage) Usage {
+	return Usage{
+		InputTokens:              max(a.InputTokens, b.InputTokens),
+		OutputTokens:             max(a.OutputTokens, b.OutputTokens),
+		CacheCreationInputTokens: max(a.CacheCreationInputTokens, b.CacheCreationInputTokens),
+		CacheReadInputTokens:     max(a.CacheReadInputTokens, b.CacheReadInputTokens),
+	}
+}
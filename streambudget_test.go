@@ -0,0 +1,146 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// turnsCLI streams turns agent turns on claude-sonnet-4-5, each a message
+// using 100k input and 10k output tokens ($0.45) followed by a tool result,
+// then a result. Each message is reported as two assistant events, like the
+// CLI does for a text and a tool use block. finished is set when the result
+// has been written.
+func turnsCLI(turns int, finished *atomic.Bool) Runner {
+	return RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		out := json.NewEncoder(cmd.Stdout)
+		write := func(v any) error {
+			if err := out.Encode(v); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+		if err := write(map[string]any{"type": "system", "subtype": "init", "session_id": "s1", "model": "claude-sonnet-4-5"}); err != nil {
+			return err
+		}
+		for i := 1; i <= turns; i++ {
+			id := fmt.Sprintf("msg_%d", i)
+			usage := map[string]int{"input_tokens": 100_000, "output_tokens": 10_000}
+			for _, block := range []map[string]any{
+				{"type": "text", "text": fmt.Sprintf("step %d. ", i)},
+				{"type": "tool_use", "id": fmt.Sprintf("t%d", i), "name": "Bash", "input": map[string]any{}},
+			} {
+				if err := write(map[string]any{"type": "assistant", "session_id": "s1", "message": map[string]any{
+					"id": id, "model": "claude-sonnet-4-5", "content": []any{block}, "usage": usage}}); err != nil {
+					return err
+				}
+			}
+			if err := write(map[string]any{"type": "user", "session_id": "s1", "message": map[string]any{
+				"role": "user", "content": []any{map[string]any{"type": "tool_result", "tool_use_id": fmt.Sprintf("t%d", i), "content": "ok"}}}}); err != nil {
+				return err
+			}
+		}
+		if err := write(map[string]any{"type": "result", "subtype": "success", "result": "done", "session_id": "s1", "total_cost_usd": 0.45 * float64(turns)}); err != nil {
+			return err
+		}
+		finished.Store(true)
+		return nil
+	})
+}
+
+func TestStreamBudgetHardLimit(t *testing.T) {
+	var finished atomic.Bool
+	c := NewClient(WithRunner(turnsCLI(5, &finished)), WithStreamBudget(StreamBudget{HardUSD: 0.8}))
+
+	s := c.Stream(context.Background(), "work")
+	var types []string
+	for ev := range s.Events() {
+		types = append(types, ev.Type)
+	}
+	resp, err := s.Result()
+
+	var berr *BudgetExceededError
+	if !errors.Is(err, ErrBudgetExceeded) || !errors.As(err, &berr) {
+		t.Fatalf("err = %v", err)
+	}
+	if !berr.Hard || berr.Limit != 0.8 || berr.Usage.InputTokens != 200_000 || berr.Output != "step 1. step 2. " || berr.SessionID != "s1" {
+		t.Errorf("budget error = %+v", berr)
+	}
+	if berr.CostUSD < 0.899 || berr.CostUSD > 0.901 {
+		t.Errorf("CostUSD = %v, want 0.9", berr.CostUSD)
+	}
+	// The run stops at the event that crossed the limit: the first assistant
+	// event of the second message.
+	if got := len(types); got != 5 || types[4] != "assistant" {
+		t.Errorf("events = %q", types)
+	}
+	if resp == nil || resp.Result != berr.Output || resp.Subtype != ResultErrorMaxBudget || resp.Usage != berr.Usage {
+		t.Errorf("resp = %+v", resp)
+	}
+	if finished.Load() {
+		t.Error("the process was not stopped")
+	}
+}
+
+func TestStreamBudgetSoftLimit(t *testing.T) {
+	var finished atomic.Bool
+	c := NewClient(WithRunner(turnsCLI(5, &finished)))
+
+	s := c.Stream(context.Background(), "work", CallStreamBudget(StreamBudget{SoftUSD: 0.8, HardUSD: 10}))
+	var types []string
+	for ev := range s.Events() {
+		types = append(types, ev.Type)
+	}
+	_, err := s.Result()
+
+	var berr *BudgetExceededError
+	if !errors.As(err, &berr) || berr.Hard || berr.Output != "step 1. step 2. " {
+		t.Fatalf("err = %v", err)
+	}
+	// The second turn finishes, including its tool result.
+	if got := len(types); got != 7 || types[6] != "user" {
+		t.Errorf("events = %q", types)
+	}
+	if finished.Load() {
+		t.Error("the process was not stopped")
+	}
+}
+
+func TestStreamBudgetNotReached(t *testing.T) {
+	var finished atomic.Bool
+	c := NewClient(WithRunner(turnsCLI(2, &finished)), WithStreamBudget(StreamBudget{SoftUSD: 1, HardUSD: 2}))
+	resp, err := c.Stream(context.Background(), "work").Result()
+	if err != nil || resp.Result != "done" || !finished.Load() {
+		t.Errorf("resp = %+v, err = %v", resp, err)
+	}
+}
+
+func TestPricing(t *testing.T) {
+	p := DefaultPricing()
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"claude-sonnet-4-5-20250929", 3},
+		{"claude-opus-4-5-20251101", 5},
+		{"claude-opus-4-1-20250805", 15},
+		{"claude-haiku-4-5", 1},
+		{"some-future-model", 15},
+	}
+	for _, tt := range tests {
+		if price, ok := p.Price(tt.model); !ok || price.InputPerMTok != tt.want {
+			t.Errorf("Price(%q) = %+v, %v", tt.model, price, ok)
+		}
+	}
+
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheReadInputTokens: 1_000_000, CacheCreationInputTokens: 1_000_000}
+	if got := p.Cost("claude-sonnet-4", usage); got < 8.549 || got > 8.551 {
+		t.Errorf("Cost = %v, want 8.55", got)
+	}
+	if got := (Pricing{"claude-": {InputPerMTok: 1}}).Cost("gpt", usage); got != 0 {
+		t.Errorf("Cost of unknown model = %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ToolDef is a Go function exposed to the agent as a tool. Create one with
+// Tool and register it with WithTools.
+type ToolDef struct {
+	// Name is the tool name. The agent sees it as mcp__go__<Name>.
+	Name string
+	// Description tells the agent what the tool does and when to use it.
+	Description string
+
+	schema string
+	parsed *jsonSchema
+	err    error
+	call   func(ctx context.Context, input json.RawMessage) (string, error)
+
+	// internal marks tools used by the library itself, which are not
+	// reported as tool events.
+	internal bool
+}
+
+// Tool wraps fn as a tool named name. The input schema is derived from In,
+// which must be a struct type (see SchemaFor for the supported tags). Input
+// is validated against the schema before fn is called. The output is sent to
+// the agent as text: strings as they are, other values encoded as JSON. An
+// error returned by fn is reported to the agent as a failed tool call.
+//
+// fn runs in the host process while the CLI is running; its context is
+// cancelled when the call's context is done or the CLI process exits.
+func Tool[In, Out any](name string, fn func(ctx context.Context, in In) (Out, error)) ToolDef {
+	t := ToolDef{Name: name}
+	t.schema, t.err = schemaForType(reflect.TypeFor[In]())
+	if t.err == nil {
+		t.parsed = &jsonSchema{}
+		t.err = json.Unmarshal([]byte(t.schema), t.parsed)
+	}
+
+	t.call = func(ctx context.Context, input json.RawMessage) (string, error) {
+		var in In
+		if err := json.Unmarshal(input, &in); err != nil {
+			return "", fmt.Errorf("invalid input: %w", err)
+		}
+		out, err := fn(ctx, in)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := any(out).(string); ok {
+			return s, nil
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return "", fmt.Errorf("encode output: %w", err)
+		}
+		return string(data), nil
+	}
+	return t
+}
+
+// WithTools registers Go functions as tools. They are served to the CLI by an
+// in-process MCP server that listens on the loopback interface for the
+// duration of each call, and are added to --allowedTools.
+func WithTools(tools ...ToolDef) Option {
+	return func(c *Client) {
+		c.tools = append(slices.Clip(c.tools), tools...)
+	}
+}
+
+// toolServerName is the MCP server name under which Go tools are exposed.
+const toolServerName = "go"
+
+// toolName returns the name under which the CLI knows the Go tool name.
+func toolName(name string) string {
+	return "mcp__" + toolServerName + "__" + name
+}
+
+// invoke validates input against the tool's schema and calls it.
+func (t *ToolDef) invoke(ctx context.Context, input json.RawMessage) (string, error) {
+	if len(input) == 0 || string(input) == "null" {
+		input = json.RawMessage("{}")
+	}
+	if t.parsed != nil {
+		var v any
+		if err := json.Unmarshal(input, &v); err != nil {
+			return "", fmt.Errorf("invalid input: %w", err)
+		}
+		var problems []string
+		validateValue(t.parsed, v, "$", &problems)
+		if len(problems) > 0 {
+			return "", fmt.Errorf("invalid input: %s", strings.Join(problems, "; "))
+		}
+	}
+	return t.call(ctx, input)
+}
+
+// ToolCallEvent is emitted on a stream when the agent calls a Go tool,
+// before the function runs.
+type ToolCallEvent struct {
+	// ToolUseID is the ID of the agent's tool_use block, when the CLI reports it.
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+// ToolCallResultEvent is emitted on a stream when a Go tool has returned.
+type ToolCallResultEvent struct {
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Name      string `json:"name"`
+	// Output is the text sent to the agent: the tool output or error message.
+	Output     string `json:"output"`
+	IsError    bool   `json:"is_error"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func (*ToolCallEvent) EventType() string       { return "tool_call" }
+func (*ToolCallResultEvent) EventType() string { return "tool_call_result" }
+
+// newToolEvent builds the StreamEvent carrying a Go tool event. The raw line
+// has the same shape as the CLI's own events: the event's fields plus "type".
+func newToolEvent(ev TypedEvent) StreamEvent {
+	data, _ := json.Marshal(ev)
+	raw := append([]byte(`{"type":"`+ev.EventType()+`",`), data[1:]...)
+	return StreamEvent{Type: ev.EventType(), Raw: raw}
+}
@@ -0,0 +1,284 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type orderQuery struct {
+	ID string `json:"id" jsonschema:"required,description=Order ID"`
+}
+
+type order struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func lookupOrder(ctx context.Context, q orderQuery) (order, error) {
+	if q.ID == "missing" {
+		return order{}, errors.New("order not found")
+	}
+	return order{ID: q.ID, Status: "shipped"}, nil
+}
+
+// mcpClient talks to the Go tool server the way the CLI does.
+type mcpClient struct {
+	t       *testing.T
+	url     string
+	headers map[string]string
+	nextID  int
+}
+
+// newMCPClient reads the tool server's address from the --mcp-config file in args.
+func newMCPClient(t *testing.T, args []string) *mcpClient {
+	t.Helper()
+	data, err := os.ReadFile(mcpConfigPath(t, args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		MCPServers map[string]MCPServer `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	srv, ok := config.MCPServers[toolServerName]
+	if !ok || srv.Type != MCPHTTP {
+		t.Fatalf("tool server missing from MCP config: %s", data)
+	}
+	return &mcpClient{t: t, url: srv.URL, headers: srv.Headers}
+}
+
+// call sends a JSON-RPC request and decodes its result into out.
+func (m *mcpClient) call(method string, params any, out any) error {
+	m.nextID++
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": m.nextID, "method": method, "params": params})
+	req, _ := http.NewRequest(http.MethodPost, m.url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rpc struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil {
+		return fmt.Errorf("status %d: %w", resp.StatusCode, err)
+	}
+	if rpc.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", rpc.Error.Code, rpc.Error.Message)
+	}
+	return json.Unmarshal(rpc.Result, out)
+}
+
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+func (m *mcpClient) callTool(name string, args any) toolResult {
+	m.t.Helper()
+	var res toolResult
+	if err := m.call("tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		m.t.Fatal(err)
+	}
+	return res
+}
+
+func TestToolServer(t *testing.T) {
+	var results []toolResult
+	var listed struct {
+		Tools []struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			InputSchema json.RawMessage `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		m := newMCPClient(t, cmd.Args)
+		var init struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := m.call("initialize", map[string]any{"protocolVersion": "2025-03-26"}, &init); err != nil {
+			return err
+		}
+		if init.ProtocolVersion != "2025-03-26" {
+			t.Errorf("protocolVersion = %q", init.ProtocolVersion)
+		}
+		if err := m.call("tools/list", nil, &listed); err != nil {
+			return err
+		}
+		results = append(results,
+			m.callTool("lookup_order", map[string]any{"id": "A1"}),
+			m.callTool("lookup_order", map[string]any{"id": "missing"}),
+			m.callTool("lookup_order", map[string]any{}),
+		)
+		io.WriteString(cmd.Stdout, "done")
+		return nil
+	})
+
+	tool := Tool("lookup_order", lookupOrder)
+	tool.Description = "Looks up an order"
+	c := NewClient(WithRunner(r), WithTools(tool))
+	if _, err := c.Ask(context.Background(), "where is my order?"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed.Tools) != 1 || listed.Tools[0].Name != "lookup_order" || listed.Tools[0].Description != "Looks up an order" {
+		t.Fatalf("tools/list = %+v", listed)
+	}
+	if !strings.Contains(string(listed.Tools[0].InputSchema), `"required":["id"]`) {
+		t.Errorf("inputSchema = %s", listed.Tools[0].InputSchema)
+	}
+	if results[0].IsError || results[0].Content[0].Text != `{"id":"A1","status":"shipped"}` {
+		t.Errorf("call = %+v", results[0])
+	}
+	if !results[1].IsError || results[1].Content[0].Text != "order not found" {
+		t.Errorf("failing call = %+v", results[1])
+	}
+	if !results[2].IsError || !strings.Contains(results[2].Content[0].Text, "invalid input") {
+		t.Errorf("invalid call = %+v", results[2])
+	}
+}
+
+func TestToolsAllowedAutomatically(t *testing.T) {
+	c := NewClient(WithAllowedTools("Read"), WithTools(Tool("lookup_order", lookupOrder)))
+	args := c.buildArgs("hi", FormatJSON)
+
+	expected := []string{"-p", "hi", "--output-format", "json", "--allowedTools", "Read", "--allowedTools", "mcp__go__lookup_order"}
+	assertArgs(t, expected, args)
+}
+
+func TestToolServerRejectsMissingToken(t *testing.T) {
+	var status int
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		m := newMCPClient(t, cmd.Args)
+		resp, err := http.Post(m.url, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		return nil
+	})
+	c := NewClient(WithRunner(r), WithTools(Tool("lookup_order", lookupOrder)))
+	if _, err := c.Ask(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+}
+
+func TestToolEventsOnStream(t *testing.T) {
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		io.WriteString(cmd.Stdout, `{"type":"system","subtype":"init","session_id":"s1"}`+"\n")
+		m := newMCPClient(t, cmd.Args)
+		var res toolResult
+		if err := m.call("tools/call", map[string]any{
+			"name":      "lookup_order",
+			"arguments": map[string]any{"id": "A1"},
+			"_meta":     map[string]any{"claudecode/toolUseId": "toolu_1"},
+		}, &res); err != nil {
+			return err
+		}
+		io.WriteString(cmd.Stdout, `{"type":"result","subtype":"success","result":"shipped","session_id":"s1"}`+"\n")
+		return nil
+	})
+	s := NewClient(WithRunner(r), WithTools(Tool("lookup_order", lookupOrder))).Stream(context.Background(), "hi")
+
+	var types []string
+	var call *ToolCallEvent
+	var result *ToolCallResultEvent
+	for ev := range s.Events() {
+		types = append(types, ev.Type)
+		typed, err := ev.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e := typed.(type) {
+		case *ToolCallEvent:
+			call = e
+		case *ToolCallResultEvent:
+			result = e
+		}
+	}
+	if _, err := s.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(types, []string{"system", "tool_call", "tool_call_result", "result"}) {
+		t.Errorf("event types = %v", types)
+	}
+	if call == nil || call.Name != "lookup_order" || call.ToolUseID != "toolu_1" || string(call.Input) != `{"id":"A1"}` {
+		t.Errorf("tool_call = %+v", call)
+	}
+	if result == nil || result.IsError || result.Output != `{"id":"A1","status":"shipped"}` {
+		t.Errorf("tool_call_result = %+v", result)
+	}
+}
+
+func TestToolCancelledWhenCallEnds(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	slow := Tool("wait", func(ctx context.Context, in struct{}) (string, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+		m := newMCPClient(t, cmd.Args)
+		go m.call("tools/call", map[string]any{"name": "wait"}, &toolResult{})
+		<-started
+		cancel()
+		return ctx.Err()
+	})
+	c := NewClient(WithRunner(r), WithTools(slow))
+	if _, err := c.Ask(ctx, "hi"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("tool still running after the call returned")
+	}
+}
+
+func TestToolConfigErrors(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"non-struct input": {WithTools(Tool("bad", func(ctx context.Context, in string) (string, error) { return in, nil }))},
+		"invalid name":     {WithTools(Tool("bad name", lookupOrder))},
+		"duplicate":        {WithTools(Tool("x", lookupOrder), Tool("x", lookupOrder))},
+		"reserved server":  {WithTools(Tool("x", lookupOrder)), WithMCPServer(toolServerName, StdioMCPServer("x"))},
+	} {
+		r := RunnerFunc(func(ctx context.Context, cmd *Command) error {
+			t.Errorf("%s: runner called", name)
+			return nil
+		})
+		c := NewClient(append(opts, WithRunner(r))...)
+		if _, err := c.Ask(context.Background(), "hi"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package claude
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// mcpProtocolVersions lists the MCP protocol versions the tool server
+// speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// validToolName matches the tool names accepted by MCP clients.
+var validToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// maxToolRequestSize bounds the size of a JSON-RPC request body.
+const maxToolRequestSize = 16 << 20
+
+// toolServer is an MCP server exposing Go tools to a single CLI invocation
+// over streamable HTTP on the loopback interface. Requests must carry a
+// random bearer token, so other local processes cannot call the tools.
+type toolServer struct {
+	tools  map[string]*ToolDef
+	token  string
+	url    string
+	srv    *http.Server
+	events chan<- StreamEvent
+
+	// ctx carries the values of the call's context to tool functions and is
+	// cancelled when the server is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startToolServer starts a tool server for tools. If events is non-nil, tool
+// calls and results are sent to it.
+func startToolServer(ctx context.Context, tools []ToolDef, events chan<- StreamEvent) (*toolServer, error) {
+	ts := &toolServer{
+		tools:  map[string]*ToolDef{},
+		events: events,
+	}
+	for i := range tools {
+		t := &tools[i]
+		switch {
+		case t.err != nil:
+			return nil, fmt.Errorf("claude: tool %q: %w", t.Name, t.err)
+		case !validToolName.MatchString(t.Name):
+			return nil, fmt.Errorf("claude: invalid tool name %q", t.Name)
+		case ts.tools[t.Name] != nil:
+			return nil, fmt.Errorf("claude: duplicate tool name %q", t.Name)
+		}
+		ts.tools[t.Name] = t
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("claude: start tool server: %w", err)
+	}
+	ts.token = hex.EncodeToString(token)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("claude: start tool server: %w", err)
+	}
+	ts.url = "http://" + ln.Addr().String() + "/mcp"
+	ts.ctx, ts.cancel = context.WithCancel(ctx)
+	ts.srv = &http.Server{Handler: ts, ReadHeaderTimeout: 10 * time.Second}
+	go ts.srv.Serve(ln)
+	return ts, nil
+}
+
+// mcpServer returns the configuration the CLI uses to connect to ts.
+func (ts *toolServer) mcpServer() MCPServer {
+	return MCPServer{
+		Type:    MCPHTTP,
+		URL:     ts.url,
+		Headers: map[string]string{"Authorization": "Bearer " + ts.token},
+	}
+}
+
+// close cancels running tool calls and waits for their handlers to return.
+func (ts *toolServer) close() {
+	ts.cancel()
+	ts.srv.Shutdown(context.Background())
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+func (ts *toolServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mcp" {
+		http.NotFound(w, r)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+ts.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		// No server-initiated messages are sent, so there is no SSE stream.
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxToolRequestSize))
+	if err != nil {
+		http.Error(w, "read request", http.StatusBadRequest)
+		return
+	}
+
+	// Tool functions are cancelled when the CLI disconnects or the server closes.
+	ctx, cancel := context.WithCancel(ts.ctx)
+	defer cancel()
+	stop := context.AfterFunc(r.Context(), cancel)
+	defer stop()
+
+	var resp any
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []rpcRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			resp = rpcFailure(nil, rpcParseError, err.Error())
+		} else {
+			var batch []rpcResponse
+			for _, req := range reqs {
+				if out := ts.handle(ctx, req); out != nil {
+					batch = append(batch, *out)
+				}
+			}
+			if batch != nil {
+				resp = batch
+			}
+		}
+	} else {
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			resp = rpcFailure(nil, rpcParseError, err.Error())
+		} else if out := ts.handle(ctx, req); out != nil {
+			resp = out
+		}
+	}
+
+	if resp == nil {
+		// Notifications and responses are acknowledged without a body.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handle processes one JSON-RPC message. It returns nil for notifications.
+func (ts *toolServer) handle(ctx context.Context, req rpcRequest) *rpcResponse {
+	if len(req.ID) == 0 {
+		return nil
+	}
+	if req.Method == "" {
+		return rpcFailure(req.ID, rpcInvalidRequest, "missing method")
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return rpcSuccess(req.ID, map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+			"serverInfo":      map[string]any{"name": "claude-go", "version": "1.0.0"},
+		})
+	case "ping":
+		return rpcSuccess(req.ID, map[string]any{})
+	case "tools/list":
+		tools := make([]map[string]any, 0, len(ts.tools))
+		for _, name := range slices.Sorted(maps.Keys(ts.tools)) {
+			t := ts.tools[name]
+			tools = append(tools, map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"inputSchema": json.RawMessage(t.schema),
+			})
+		}
+		return rpcSuccess(req.ID, map[string]any{"tools": tools})
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+			Meta      struct {
+				ToolUseID string `json:"claudecode/toolUseId"`
+			} `json:"_meta"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.ID, rpcInvalidParams, err.Error())
+		}
+		t := ts.tools[params.Name]
+		if t == nil {
+			return rpcFailure(req.ID, rpcInvalidParams, "unknown tool "+params.Name)
+		}
+		output, isError := ts.callTool(ctx, t, params.Meta.ToolUseID, params.Arguments)
+		return rpcSuccess(req.ID, map[string]any{
+			"content": []map[string]any{{"type": "text", "text": output}},
+			"isError": isError,
+		})
+	default:
+		return rpcFailure(req.ID, rpcMethodNotFound, "method not found: "+req.Method)
+	}
+}
+
+// callTool runs t and reports the call and its result as stream events.
+func (ts *toolServer) callTool(ctx context.Context, t *ToolDef, toolUseID string, input json.RawMessage) (string, bool) {
+	if t.internal {
+		output, err := t.invoke(ctx, input)
+		if err != nil {
+			return err.Error(), true
+		}
+		return output, false
+	}
+
+	ts.emit(&ToolCallEvent{ToolUseID: toolUseID, Name: t.Name, Input: input})
+
+	start := time.Now()
+	output, err := t.invoke(ctx, input)
+	isError := err != nil
+	if isError {
+		output = err.Error()
+	}
+
+	ts.emit(&ToolCallResultEvent{
+		ToolUseID:  toolUseID,
+		Name:       t.Name,
+		Output:     output,
+		IsError:    isError,
+		DurationMS: time.Since(start).Milliseconds(),
+	})
+	return output, isError
+}
+
+// emit sends a tool event to the stream, if there is one.
+func (ts *toolServer) emit(ev TypedEvent) {
+	if ts.events == nil {
+		return
+	}
+	select {
+	case ts.events <- newToolEvent(ev):
+	case <-ts.ctx.Done():
+	}
+}
+
+func rpcSuccess(id json.RawMessage, result any) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
@@ -1,6 +1,9 @@
 package claude
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // OutputFormat specifies the output format for the claude CLI.
 type OutputFormat string
@@ -11,17 +14,109 @@ const (
 	FormatStreamJSON OutputFormat = "stream-json"
 )
 
-// Response represents the parsed JSON response from claude -p --output-format json.
+// PermissionMode is the value of the --permission-mode flag.
+type PermissionMode string
+
+const (
+	PermissionDefault           PermissionMode = "default"
+	PermissionAcceptEdits       PermissionMode = "acceptEdits"
+	PermissionBypassPermissions PermissionMode = "bypassPermissions"
+	PermissionPlan              PermissionMode = "plan"
+)
+
+// Agent defines a custom subagent passed to the CLI with --agents.
+type Agent struct {
+	Description string   `json:"description"`
+	Prompt      string   `json:"prompt"`
+	Tools       []string `json:"tools,omitempty"`
+	Model       string   `json:"model,omitempty"`
+}
+
+// Result subtypes reported by the CLI in Response.Subtype.
+const (
+	ResultSuccess              = "success"
+	ResultErrorMaxTurns        = "error_max_turns"
+	ResultErrorMaxBudget       = "error_max_budget_usd"
+	ResultErrorDuringExecution = "error_during_execution"
+)
+
+// Response represents the parsed JSON response from claude -p --output-format json,
+// which is also the result event of a stream.
 type Response struct {
+	// Subtype is ResultSuccess or one of the ResultError subtypes.
+	Subtype string `json:"subtype,omitempty"`
+	// IsError is set when the run failed. Methods returning a Response then
+	// also return an *Error.
+	IsError   bool   `json:"is_error"`
 	SessionID string `json:"session_id"`
 	Result    string `json:"result"`
-	Cost      Cost   `json:"cost_usd"`
-	Usage     Usage  `json:"usage"`
 	Model     string `json:"model"`
-	Duration  int    `json:"duration_ms"`
+	NumTurns  int    `json:"num_turns"`
+	// Duration is the wall-clock time of the run and DurationAPI the time
+	// spent waiting for the API, in milliseconds.
+	Duration    int `json:"duration_ms"`
+	DurationAPI int `json:"duration_api_ms"`
+	// TotalCostUSD is the cost of the run as computed by the CLI.
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        Usage   `json:"usage"`
+	// ModelUsage breaks usage and cost down by model, including models used
+	// by subagents and for background tasks.
+	ModelUsage map[string]ModelUsage `json:"modelUsage,omitempty"`
+	// PermissionDenials lists the tool uses that were denied during the run.
+	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
+
+	// Cost repeats Usage and TotalCostUSD.
+	//
+	// Deprecated: Use Usage and TotalCostUSD.
+	Cost Cost `json:"-"`
+
+	// Attempts is the number of CLI round-trips AskWithSchema needed to
+	// produce a schema-valid result (1 when no repair was necessary).
+	Attempts int `json:"-"`
+	// TotalUsage sums Usage over all attempts.
+	TotalUsage Usage `json:"-"`
+	// TotalCostAllAttemptsUSD sums TotalCostUSD over all attempts;
+	// TotalCostUSD is the cost of the last attempt only.
+	TotalCostAllAttemptsUSD float64 `json:"-"`
+	// MCPServers is the MCP server status from the stream's init event.
+	// It is only set for streaming calls.
+	MCPServers []MCPServerStatus `json:"-"`
+	// PermissionDecisions records the answers of the WithPermissionHandler
+	// handler during the run, in order.
+	PermissionDecisions []PermissionDecision `json:"-"`
+	// QueueWait is how long the call waited for a slot under
+	// WithMaxConcurrency.
+	QueueWait time.Duration `json:"-"`
+}
+
+// UnmarshalJSON decodes a result and fills the deprecated Cost field. The
+// cost_usd field of older CLI versions is read into TotalCostUSD.
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type plain Response
+	var v struct {
+		plain
+		LegacyCostUSD json.RawMessage `json:"cost_usd"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Response(v.plain)
+	if r.TotalCostUSD == 0 && len(v.LegacyCostUSD) > 0 {
+		json.Unmarshal(v.LegacyCostUSD, &r.TotalCostUSD)
+	}
+	r.Cost = Cost{
+		InputTokens:         r.Usage.InputTokens,
+		OutputTokens:        r.Usage.OutputTokens,
+		CacheReadTokens:     r.Usage.CacheReadInputTokens,
+		CacheCreationTokens: r.Usage.CacheCreationInputTokens,
+		TotalUSD:            r.TotalCostUSD,
+	}
+	return nil
 }
 
 // Cost holds token cost information.
+//
+// Deprecated: Use Response.Usage and Response.TotalCostUSD.
 type Cost struct {
 	InputTokens         int     `json:"input_tokens"`
 	OutputTokens        int     `json:"output_tokens"`
@@ -32,12 +127,47 @@ type Cost struct {
 
 // Usage holds token usage counters.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// Add returns the sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		InputTokens:              u.InputTokens + o.InputTokens,
+		OutputTokens:             u.OutputTokens + o.OutputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens + o.CacheCreationInputTokens,
+		CacheReadInputTokens:     u.CacheReadInputTokens + o.CacheReadInputTokens,
+	}
+}
+
+// ModelUsage is the usage and cost of a single model during a run.
+type ModelUsage struct {
+	InputTokens              int     `json:"inputTokens"`
+	OutputTokens             int     `json:"outputTokens"`
+	CacheReadInputTokens     int     `json:"cacheReadInputTokens"`
+	CacheCreationInputTokens int     `json:"cacheCreationInputTokens"`
+	WebSearchRequests        int     `json:"webSearchRequests"`
+	CostUSD                  float64 `json:"costUSD"`
+	ContextWindow            int     `json:"contextWindow,omitempty"`
+}
+
+// PermissionDenial is a tool use that was denied during a run.
+type PermissionDenial struct {
+	ToolName  string          `json:"tool_name"`
+	ToolUseID string          `json:"tool_use_id"`
+	ToolInput json.RawMessage `json:"tool_input"`
 }
 
 // StreamEvent represents a single event from claude -p --output-format stream-json.
+// Use Decode to obtain the typed representation of the event.
 type StreamEvent struct {
-	Type  string          `json:"type"`
-	Event json.RawMessage `json:"event,omitempty"`
+	Type    string          `json:"type"`
+	Subtype string          `json:"subtype,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+
+	// Raw holds the complete stream line the event was parsed from.
+	Raw json.RawMessage `json:"-"`
 }
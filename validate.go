@@ -0,0 +1,234 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError reports a structured result that is not valid JSON or does
+// not match its schema.
+type ValidationError struct {
+	// Result is the raw result text returned by the CLI.
+	Result string
+	// Problems lists each violation, prefixed with its JSON path.
+	Problems []string
+	// Err is the JSON syntax error when the result could not be parsed.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "claude: result does not match schema: " + strings.Join(e.Problems, "; ")
+}
+
+// Unwrap returns the JSON syntax error, if any.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// decodeResult decodes a validated structured result into v.
+func decodeResult(result string, v any) error {
+	if err := json.Unmarshal([]byte(extractJSON(result)), v); err != nil {
+		return &ValidationError{Result: result, Problems: []string{err.Error()}, Err: err}
+	}
+	return nil
+}
+
+// validateResult checks that result is JSON matching schema. It returns a
+// *ValidationError describing every violation found.
+func validateResult(result, schema string) error {
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		return fmt.Errorf("claude: invalid JSON schema: %w", err)
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(extractJSON(result)), &v); err != nil {
+		return &ValidationError{Result: result, Problems: []string{"$: result is not valid JSON: " + err.Error()}, Err: err}
+	}
+
+	var problems []string
+	validateValue(&s, v, "$", &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Result: result, Problems: problems}
+	}
+	return nil
+}
+
+// extractJSON trims whitespace and a surrounding Markdown code fence.
+func extractJSON(result string) string {
+	s := strings.TrimSpace(result)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(s[3:], "```")
+	if nl := strings.IndexByte(s, '\n'); nl >= 0 && !strings.ContainsAny(s[:nl], "{[\"") {
+		s = s[nl+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// validateValue appends a problem for every constraint of s violated by v.
+func validateValue(s *jsonSchema, v any, path string, problems *[]string) {
+	report := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, alt := range s.AnyOf {
+			var sub []string
+			validateValue(alt, v, path, &sub)
+			if len(sub) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("does not match any allowed schema")
+		}
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasType(v, t) }) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), typeName(v))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return jsonEqual(e, v) }) {
+		report("value %s is not one of %s", compactJSON(v), compactJSON(s.Enum))
+	}
+	if s.Const != nil && !jsonEqual(s.Const, v) {
+		report("value %s must equal %s", compactJSON(v), compactJSON(s.Const))
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			report("%v is less than minimum %v", val, *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			report("%v is greater than maximum %v", val, *s.Maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.MinLength != nil && n < *s.MinLength {
+			report("length %d is less than minLength %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report("length %d is greater than maxLength %d", n, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(val) {
+				report("does not match pattern %q", s.Pattern)
+			}
+		}
+	case []any:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			report("has %d items, fewer than minItems %d", len(val), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			report("has %d items, more than maxItems %d", len(val), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				validateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "." + k
+			if prop, ok := s.Properties[k]; ok {
+				validateValue(prop, val[k], child, problems)
+				continue
+			}
+			if s.AdditionalProperties == nil {
+				continue
+			}
+			if !s.AdditionalProperties.allowed {
+				report("unexpected property %q", k)
+			} else if s.AdditionalProperties.schema != nil {
+				validateValue(s.AdditionalProperties.schema, val[k], child, problems)
+			}
+		}
+	}
+}
+
+// hasType reports whether v is an instance of the JSON Schema type t.
+func hasType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	}
+	return true
+}
+
+// typeName returns the JSON type name of a decoded value.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual compares two values by their JSON encoding.
+func jsonEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}